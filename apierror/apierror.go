@@ -0,0 +1,121 @@
+// Package apierror defines the error responses of the api. Every error is sent as
+//
+//	{"code": "user_exists", "message": "User already exists", "details": ..., "requestId": "..."}
+//
+// where code is one of the stable codes in codes.go, so clients don't need to parse messages
+package apierror
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Code identifies a kind of error. Codes never change once published, unlike messages
+type Code string
+
+// Error is an error response. Internal holds the cause, which is logged but never sent to clients
+type Error struct {
+	Status   int
+	Code     Code
+	Message  string
+	Details  interface{}
+	Internal error
+}
+
+// New returns an error sent with status, code, and message
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Error describes the error for logs, including the internal cause
+func (e *Error) Error() string {
+	msg := string(e.Code) + ": " + e.Message
+	if e.Internal != nil {
+		msg += ": " + e.Internal.Error()
+	}
+
+	return msg
+}
+
+// WithMessage returns a copy of e with another message. The errors in codes.go are shared, so
+// they are never changed in place
+func (e *Error) WithMessage(message string) *Error {
+	copied := *e
+	copied.Message = message
+
+	return &copied
+}
+
+// WithDetails returns a copy of e with details, ie the invalid fields of a request
+func (e *Error) WithDetails(details interface{}) *Error {
+	copied := *e
+	copied.Details = details
+
+	return &copied
+}
+
+// WithInternal returns a copy of e caused by err
+func (e *Error) WithInternal(err error) *Error {
+	copied := *e
+	copied.Internal = err
+
+	return &copied
+}
+
+// Internal returns an internal_error with message, caused by err. Use it for failures of the
+// database or storage, whose errors must not reach clients
+func Internal(message string, err error) *Error {
+	return ErrInternal.WithMessage(message).WithInternal(err)
+}
+
+// Response is the json body of an error response
+type Response struct {
+	Code      Code        `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+}
+
+// From converts err to an *Error. Errors of echo and its middleware keep their status and message,
+// and get the code of their status. Any other error is hidden behind an internal_error
+func From(err error) *Error {
+	switch e := err.(type) {
+	case *Error:
+		return e
+	case *echo.HTTPError:
+		message, ok := e.Message.(string)
+		if !ok {
+			message = http.StatusText(e.Code)
+		}
+
+		return &Error{Status: e.Code, Code: codeForStatus(e.Code), Message: message, Internal: e.Internal}
+	default:
+		return ErrInternal.WithInternal(err)
+	}
+}
+
+// Handler is an echo.HTTPErrorHandler sending errors as a Response. The request id is taken from
+// the X-Request-ID response header, set by the logging middleware
+func Handler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	apiErr := From(err)
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(apiErr.Status)
+	} else {
+		err = c.JSON(apiErr.Status, &Response{
+			Code:      apiErr.Code,
+			Message:   apiErr.Message,
+			Details:   apiErr.Details,
+			RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+		})
+	}
+
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
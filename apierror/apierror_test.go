@@ -0,0 +1,71 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// serve sends a request to a route returning err, and decodes the error response
+func serve(t *testing.T, err error) (*httptest.ResponseRecorder, *Response) {
+	e := echo.New()
+	e.HTTPErrorHandler = Handler
+	e.GET("/", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+		return err
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	resp := &Response{}
+	if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+
+	return rec, resp
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    Code
+		message string
+	}{
+		{"api error", ErrUserExists, http.StatusConflict, "user_exists", "User already exists"},
+		{"echo error", echo.NewHTTPError(http.StatusMethodNotAllowed, "nope"), http.StatusMethodNotAllowed, "method_not_allowed", "nope"},
+		{"unknown status", echo.NewHTTPError(http.StatusTeapot, "short and stout"), http.StatusTeapot, "bad_request", "short and stout"},
+		{"internal cause", Internal("Could not load posts", errors.New("connection refused")), http.StatusInternalServerError, "internal_error", "Could not load posts"},
+		{"plain error", errors.New("server selection timeout"), http.StatusInternalServerError, "internal_error", "Internal server error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := serve(t, tt.err)
+
+			if rec.Code != tt.status || resp.Code != tt.code || resp.Message != tt.message || resp.RequestID != "req-1" {
+				t.Fatalf("unexpected response %d %+v", rec.Code, resp)
+			}
+
+			// driver errors must never reach clients
+			if strings.Contains(rec.Body.String(), "connection refused") || strings.Contains(rec.Body.String(), "selection") {
+				t.Fatalf("internal error leaked: %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestWithDoesNotChangeCatalogue(t *testing.T) {
+	ErrValidation.WithDetails([]string{"title"}).WithMessage("changed")
+
+	if ErrValidation.Details != nil || ErrValidation.Message != "Invalid request" {
+		t.Fatalf("shared error was modified: %+v", ErrValidation)
+	}
+}
@@ -0,0 +1,74 @@
+package apierror
+
+import "net/http"
+
+// Generic errors, also used for the errors of echo and its middleware by their status
+var (
+	ErrBadRequest           = New(http.StatusBadRequest, "bad_request", "Bad request")
+	ErrUnauthorized         = New(http.StatusUnauthorized, "unauthorized", "Unauthorized")
+	ErrForbidden            = New(http.StatusForbidden, "forbidden", "Forbidden")
+	ErrNotFound             = New(http.StatusNotFound, "not_found", "Not found")
+	ErrMethodNotAllowed     = New(http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	ErrConflict             = New(http.StatusConflict, "conflict", "Conflict")
+	ErrPayloadTooLarge      = New(http.StatusRequestEntityTooLarge, "payload_too_large", "Request is too large")
+	ErrUnsupportedMediaType = New(http.StatusUnsupportedMediaType, "unsupported_media_type", "Unsupported media type")
+	ErrTooManyRequests      = New(http.StatusTooManyRequests, "too_many_requests", "Too many requests")
+	ErrInternal             = New(http.StatusInternalServerError, "internal_error", "Internal server error")
+	ErrUnavailable          = New(http.StatusServiceUnavailable, "service_unavailable", "Service unavailable")
+)
+
+// Request errors
+var (
+	ErrValidation = New(http.StatusBadRequest, "validation_failed", "Invalid request")
+	ErrInvalidID  = New(http.StatusBadRequest, "invalid_id", "Could not parse provided id. Please provide a valid post id")
+	// ErrInvalidCursor is sent for cursors which weren't the nextCursor or prevCursor of a page
+	ErrInvalidCursor = New(http.StatusBadRequest, "invalid_cursor", "Invalid cursor. Please use the nextCursor or prevCursor of a page")
+)
+
+// Account and login errors
+var (
+	ErrMissingCredentials = New(http.StatusBadRequest, "missing_credentials", "Please provide a user name and password")
+	ErrInvalidCredentials = New(http.StatusUnauthorized, "invalid_credentials", "Not a valid user or password")
+	ErrUserExists         = New(http.StatusConflict, "user_exists", "User already exists")
+	ErrUserNotFound       = New(http.StatusBadRequest, "user_not_found", "User doesn't exist")
+	ErrMissingToken       = New(http.StatusBadRequest, "missing_token", "missing or malformed jwt")
+	ErrInvalidToken       = New(http.StatusUnauthorized, "invalid_token", "invalid jwt")
+	ErrLoginRequired      = New(http.StatusUnauthorized, "login_required", "Please login")
+	ErrSessionExpired     = New(http.StatusUnauthorized, "session_expired", "Login expired. Please login")
+	ErrInvalidCSRFToken   = New(http.StatusForbidden, "invalid_csrf_token", "Missing or invalid csrf token. Please send the _csrf cookie back in the X-CSRF-Token header")
+)
+
+// Post errors
+var (
+	ErrPostNotFound  = New(http.StatusNotFound, "post_not_found", "Post not found")
+	ErrPostNotOwned  = New(http.StatusBadRequest, "post_not_owned", "Could not modify post for current user.")
+	ErrImageRequired = New(http.StatusBadRequest, "image_required", "Please provide an image file")
+	ErrImageType     = New(http.StatusUnsupportedMediaType, "image_type", "Image must be of the following file type: jpeg, gif, png, or webp")
+	ErrImageTooLarge = New(http.StatusRequestEntityTooLarge, "image_too_large", "Image is too large")
+)
+
+// byStatus gives errors from outside this package the code of their status
+var byStatus = map[int]Code{}
+
+func init() {
+	for _, e := range []*Error{
+		ErrBadRequest, ErrUnauthorized, ErrForbidden, ErrNotFound, ErrMethodNotAllowed, ErrConflict,
+		ErrPayloadTooLarge, ErrUnsupportedMediaType, ErrTooManyRequests, ErrInternal, ErrUnavailable,
+	} {
+		byStatus[e.Status] = e.Code
+	}
+}
+
+// codeForStatus returns the generic code of status. Unknown client errors are bad_request, and
+// unknown server errors internal_error
+func codeForStatus(status int) Code {
+	if code, ok := byStatus[status]; ok {
+		return code
+	}
+
+	if status < http.StatusInternalServerError {
+		return ErrBadRequest.Code
+	}
+
+	return ErrInternal.Code
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Claims are the contents of our access tokens
+type Claims struct {
+	UserID    string `json:"userId"`
+	UserName  string `json:"userName"`
+	SessionID string `json:"sid"`
+	jwt.StandardClaims
+}
+
+// Principal is the verified identity of a request, stored in the echo context by the JWT middleware
+type Principal struct {
+	UserID    primitive.ObjectID
+	UserName  string
+	SessionID primitive.ObjectID
+}
+
+// NewClaims returns the claims of an access token for principal, expiring at expiresAt (a unix time)
+func NewClaims(principal *Principal, expiresAt int64) *Claims {
+	return &Claims{
+		UserID:    principal.UserID.Hex(),
+		UserName:  principal.UserName,
+		SessionID: principal.SessionID.Hex(),
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expiresAt,
+		},
+	}
+}
+
+// Valid checks the expiry of the token, and that every claim we rely on is present and well formed
+func (claims *Claims) Valid() error {
+	if err := claims.StandardClaims.Valid(); err != nil {
+		return err
+	}
+
+	if claims.ExpiresAt == 0 {
+		return errors.New("jwt has no exp claim")
+	}
+
+	if _, err := primitive.ObjectIDFromHex(claims.UserID); err != nil {
+		return errors.New("jwt userId claim is missing or not a valid id")
+	}
+
+	if claims.UserName == "" {
+		return errors.New("jwt userName claim is missing")
+	}
+
+	if _, err := primitive.ObjectIDFromHex(claims.SessionID); err != nil {
+		return errors.New("jwt sid claim is missing or not a valid id")
+	}
+
+	return nil
+}
+
+// Principal converts validated claims to a Principal
+func (claims *Claims) Principal() *Principal {
+	userID, _ := primitive.ObjectIDFromHex(claims.UserID)
+	sessionID, _ := primitive.ObjectIDFromHex(claims.SessionID)
+
+	return &Principal{UserID: userID, UserName: claims.UserName, SessionID: sessionID}
+}
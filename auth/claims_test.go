@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/apierror"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestClaimsValid(t *testing.T) {
+	ks := RandomKeySet()
+	userID := primitive.NewObjectID().Hex()
+	sessionID := primitive.NewObjectID().Hex()
+
+	// claims returns valid claims, with changes applied. A nil value removes a claim
+	claims := func(changes jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"userId": userID, "userName": "ann", "sid": sessionID, "exp": time.Now().Add(time.Hour).Unix()}
+
+		for name, value := range changes {
+			if value == nil {
+				delete(c, name)
+			} else {
+				c[name] = value
+			}
+		}
+
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		message string
+	}{
+		{"no userId", claims(jwt.MapClaims{"userId": nil}), "invalid jwt: jwt userId claim is missing or not a valid id"},
+		{"numeric userId", claims(jwt.MapClaims{"userId": 42}), "invalid jwt: userId claim has the wrong type"},
+		{"userId not an id", claims(jwt.MapClaims{"userId": "ann"}), "invalid jwt: jwt userId claim is missing or not a valid id"},
+		{"no userName", claims(jwt.MapClaims{"userName": nil}), "invalid jwt: jwt userName claim is missing"},
+		{"no sid", claims(jwt.MapClaims{"sid": nil}), "invalid jwt: jwt sid claim is missing or not a valid id"},
+		{"no exp", claims(jwt.MapClaims{"exp": nil}), "invalid jwt: jwt has no exp claim"},
+		{"expired", claims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}), "jwt has expired"},
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = apierror.Handler
+
+	reached := false
+	e.GET("/", func(c echo.Context) error {
+		reached = true
+		return c.NoContent(http.StatusOK)
+	}, JWT(ks))
+
+	for _, test := range tests {
+		token, err := ks.Sign(test.claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		e.ServeHTTP(rec, req)
+
+		resp := &apierror.Response{}
+		if err := json.NewDecoder(rec.Body).Decode(resp); err != nil {
+			t.Fatalf("%s: decoding response: %v", test.name, err)
+		}
+
+		if rec.Code != http.StatusUnauthorized || resp.Code != apierror.ErrInvalidToken.Code || resp.Message != test.message {
+			t.Errorf("%s: expected 401 %s %q, got %d %s %q", test.name, apierror.ErrInvalidToken.Code, test.message, rec.Code, resp.Code, resp.Message)
+		}
+
+		if reached {
+			t.Fatalf("%s: expected the handler not to be reached", test.name)
+		}
+	}
+
+	token, err := ks.Sign(claims(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || !reached {
+		t.Fatalf("expected valid claims to reach the handler, got %d %s", rec.Code, rec.Body)
+	}
+}
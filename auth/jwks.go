@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"sort"
+)
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA public key fields
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// ECDSA public key fields
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set, as served from /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set so other services can verify our tokens. HMAC secrets
+// are never included
+func (ks *KeySet) JWKS() *JWKS {
+	set := &JWKS{Keys: []JWK{}}
+
+	for kid, k := range ks.publicKeys() {
+		jwk := JWK{Kid: kid, Use: "sig", Alg: k.method.Alg()}
+
+		switch public := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encodeBase64URL(public.N.Bytes())
+			jwk.E = encodeBase64URL(big.NewInt(int64(public.E)).Bytes())
+		case *ecdsa.PublicKey:
+			params := public.Curve.Params()
+			size := (params.BitSize + 7) / 8
+
+			jwk.Kty = "EC"
+			jwk.Crv = params.Name
+			jwk.X = encodeBase64URL(padBytes(public.X.Bytes(), size))
+			jwk.Y = encodeBase64URL(padBytes(public.Y.Bytes(), size))
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	// map order is random, keep the response stable
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set
+}
+
+// encodeBase64URL encodes b as unpadded base64url, as JWKs require
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// padBytes left pads b with zeros to size bytes, since EC coordinates have a fixed length
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+
+	return padded
+}
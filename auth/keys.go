@@ -0,0 +1,320 @@
+// Package auth manages the keys used to sign and verify json web tokens
+package auth
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// DefaultKeyID is the kid of a key provided as a single secret
+const DefaultKeyID = "default"
+
+// ErrNoKeys is returned when a KeySet is created without any keys
+var ErrNoKeys = errors.New("auth: no jwt signing keys configured")
+
+// KeyConfig describes where keys are loaded from
+type KeyConfig struct {
+	// Secret is a single HS256 secret, used with the kid DefaultKeyID
+	Secret string
+	// KeyFile holds one "kid:secret" HS256 pair per line. Blank lines or lines starting with # are ignored
+	KeyFile string
+	// PEMKeys maps kids to PEM files. A private RSA or ECDSA key can sign and verify tokens
+	// (RS256, or ES256/ES384/ES512 depending on the curve). A public key only verifies them
+	PEMKeys map[string]string
+	// SigningKID names the key new tokens are signed with. When empty, the first key of the
+	// key file, or the secret, is used
+	SigningKID string
+}
+
+// key is a single verification key, and the private key for signing if we have it
+type key struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet holds every key which is accepted when verifying tokens, identified by their kid.
+// New tokens are signed with a single key. To rotate keys, add the new key and make it the
+// signing key, then remove the old key once all tokens signed with it have expired
+type KeySet struct {
+	keys       map[string]*key
+	signingKID string
+}
+
+// NewKeySet creates a KeySet of HS256 keys from a map of kid to secret. New tokens are signed
+// with the key named signingKID
+func NewKeySet(secrets map[string][]byte, signingKID string) (*KeySet, error) {
+	ks := &KeySet{keys: map[string]*key{}}
+
+	for kid, secret := range secrets {
+		if err := ks.addSecret(kid, secret); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ks.setSigningKey(signingKID); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// RandomKeySet returns a KeySet with a single random key. Tokens signed with it stop working once
+// the process exits, so it is only suited to development
+func RandomKeySet() *KeySet {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+
+	ks, _ := NewKeySet(map[string][]byte{DefaultKeyID: secret}, DefaultKeyID)
+
+	return ks
+}
+
+// LoadKeySet builds a KeySet from all configured sources. Keys from every source are accepted
+// when verifying tokens, so symmetric and asymmetric keys can be rotated into each other
+func LoadKeySet(cfg KeyConfig) (*KeySet, error) {
+	ks := &KeySet{keys: map[string]*key{}}
+	firstKID := ""
+
+	if cfg.Secret != "" {
+		if err := ks.addSecret(DefaultKeyID, []byte(cfg.Secret)); err != nil {
+			return nil, err
+		}
+
+		firstKID = DefaultKeyID
+	}
+
+	if cfg.KeyFile != "" {
+		kid, err := ks.loadKeyFile(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if kid != "" {
+			firstKID = kid
+		}
+	}
+
+	for kid, path := range cfg.PEMKeys {
+		if err := ks.loadPEM(kid, path); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ks.keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	signingKID := cfg.SigningKID
+	if signingKID == "" {
+		signingKID = firstKID
+	}
+
+	if signingKID == "" {
+		return nil, errors.New("auth: choose which jwt key signs new tokens")
+	}
+
+	if err := ks.setSigningKey(signingKID); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// addSecret adds an HS256 key
+func (ks *KeySet) addSecret(kid string, secret []byte) error {
+	if len(secret) == 0 {
+		return fmt.Errorf("auth: jwt key %q has an empty secret", kid)
+	}
+
+	return ks.add(kid, &key{method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret})
+}
+
+// add stores k under kid, rejecting duplicates
+func (ks *KeySet) add(kid string, k *key) error {
+	if kid == "" {
+		return errors.New("auth: jwt keys need a kid")
+	}
+
+	if _, ok := ks.keys[kid]; ok {
+		return fmt.Errorf("auth: jwt key %q is configured more than once", kid)
+	}
+
+	ks.keys[kid] = k
+
+	return nil
+}
+
+// setSigningKey makes sure kid exists and holds a private key before signing with it
+func (ks *KeySet) setSigningKey(kid string) error {
+	k, ok := ks.keys[kid]
+	if !ok {
+		return fmt.Errorf("auth: jwt signing key %q is not one of the configured keys", kid)
+	}
+
+	if k.signKey == nil {
+		return fmt.Errorf("auth: jwt signing key %q is a public key, and cannot sign tokens", kid)
+	}
+
+	ks.signingKID = kid
+
+	return nil
+}
+
+// loadKeyFile reads kid:secret pairs from path, returning the first kid
+func (ks *KeySet) loadKeyFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	firstKID := ""
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("auth: %s:%d is not of the form kid:secret", path, lineNum)
+		}
+
+		kid := strings.TrimSpace(parts[0])
+		if err := ks.addSecret(kid, []byte(strings.TrimSpace(parts[1]))); err != nil {
+			return "", fmt.Errorf("%v (%s:%d)", err, path, lineNum)
+		}
+
+		if firstKID == "" {
+			firstKID = kid
+		}
+	}
+
+	return firstKID, scanner.Err()
+}
+
+// loadPEM reads an RSA or ECDSA key from a PEM file. Private keys are tried first
+func (ks *KeySet) loadPEM(kid string, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return ks.add(kid, &key{method: jwt.SigningMethodRS256, signKey: private, verifyKey: &private.PublicKey})
+	}
+
+	if private, err := jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+		method, err := ecdsaMethod(&private.PublicKey)
+		if err != nil {
+			return err
+		}
+
+		return ks.add(kid, &key{method: method, signKey: private, verifyKey: &private.PublicKey})
+	}
+
+	if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return ks.add(kid, &key{method: jwt.SigningMethodRS256, verifyKey: public})
+	}
+
+	if public, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		method, err := ecdsaMethod(public)
+		if err != nil {
+			return err
+		}
+
+		return ks.add(kid, &key{method: method, verifyKey: public})
+	}
+
+	return fmt.Errorf("auth: %s does not contain an RSA or ECDSA key in PEM format", path)
+}
+
+// ecdsaMethod picks the signing method matching the key's curve
+func ecdsaMethod(public *ecdsa.PublicKey) (jwt.SigningMethod, error) {
+	switch public.Curve.Params().BitSize {
+	case 256:
+		return jwt.SigningMethodES256, nil
+	case 384:
+		return jwt.SigningMethodES384, nil
+	case 521:
+		return jwt.SigningMethodES512, nil
+	}
+
+	return nil, fmt.Errorf("auth: unsupported ECDSA curve %s", public.Curve.Params().Name)
+}
+
+// Sign creates a token for claims signed with the current signing key, and records the key's kid
+// in the token header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	k := ks.keys[ks.signingKID]
+
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = ks.signingKID
+
+	return token.SignedString(k.signKey)
+}
+
+// Keyfunc finds the verification key for a token from its kid. The token must use the algorithm
+// of that key, so a public key can never be used as an HMAC secret
+func (ks *KeySet) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unexpected jwt key id=%v", t.Header["kid"])
+	}
+
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected jwt signing method=%v", t.Header["alg"])
+	}
+
+	return k.verifyKey, nil
+}
+
+// SigningKeyID returns the kid of the key new tokens are signed with
+func (ks *KeySet) SigningKeyID() string {
+	return ks.signingKID
+}
+
+// String avoids printing secrets when a KeySet is logged
+func (ks *KeySet) String() string {
+	kids := make([]string, 0, len(ks.keys))
+
+	for kid, k := range ks.keys {
+		kids = append(kids, kid+"/"+k.method.Alg())
+	}
+
+	return fmt.Sprintf("KeySet{signing: %s, keys: %s}", ks.signingKID, strings.Join(kids, ","))
+}
+
+// publicKeys returns the asymmetric verification keys by kid
+func (ks *KeySet) publicKeys() map[string]*key {
+	keys := map[string]*key{}
+
+	for kid, k := range ks.keys {
+		switch k.verifyKey.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			keys[kid] = k
+		}
+	}
+
+	return keys
+}
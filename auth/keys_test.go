@@ -0,0 +1,359 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// writeFile writes data to a file called name in a temporary directory, and returns its path
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// writePEM writes der as a PEM block of type blockType
+func writePEM(t *testing.T, name string, blockType string, der []byte) string {
+	t.Helper()
+
+	return writeFile(t, name, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+}
+
+// writePublicPEM writes the PKIX encoding of public
+func writePublicPEM(t *testing.T, name string, public interface{}) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return writePEM(t, name, "PUBLIC KEY", der)
+}
+
+// sign signs a token for a fixed user with ks
+func sign(t *testing.T, ks *KeySet) string {
+	t.Helper()
+
+	token, err := ks.Sign(&jwt.StandardClaims{Subject: "ann", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+// verifies reports whether ks accepts token
+func verifies(ks *KeySet, token string) bool {
+	parsed, err := jwt.ParseWithClaims(token, &jwt.StandardClaims{}, ks.Keyfunc)
+
+	return err == nil && parsed.Valid
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	path := writeFile(t, "keys", []byte(strings.Join([]string{
+		"# rotated in 2024",
+		"",
+		"  new : s3cret:with:colons  ",
+		"old:older-secret",
+	}, "\n")))
+
+	ks, err := LoadKeySet(KeyConfig{KeyFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ks.SigningKeyID() != "new" {
+		t.Fatalf("expected the first key to sign, got %q", ks.SigningKeyID())
+	}
+
+	if secret := ks.keys["new"].signKey.([]byte); string(secret) != "s3cret:with:colons" {
+		t.Fatalf("expected the secret after the first colon, got %q", secret)
+	}
+
+	if _, ok := ks.keys["old"]; !ok {
+		t.Fatalf("expected key old, got %s", ks)
+	}
+
+	invalid := map[string]string{
+		"no colon":    "new:secret\nnope\n",
+		"no kid":      ":secret\n",
+		"no secret":   "new:\n",
+		"duplicate":   "new:secret\nnew:other\n",
+		"unknown kid": "new:secret\n",
+	}
+
+	for name, content := range invalid {
+		cfg := KeyConfig{KeyFile: writeFile(t, "keys", []byte(content))}
+		if name == "unknown kid" {
+			cfg.SigningKID = "missing"
+		}
+
+		if _, err := LoadKeySet(cfg); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	secrets := map[string][]byte{"old": []byte("old-secret"), "new": []byte("new-secret")}
+
+	before, err := NewKeySet(secrets, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldToken := sign(t, before)
+
+	after, err := NewKeySet(secrets, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !verifies(after, oldToken) {
+		t.Fatal("expected a token signed with the old key to verify after the signing key changed")
+	}
+
+	if !verifies(before, sign(t, after)) {
+		t.Fatal("expected a token signed with the new key to verify with both keys configured")
+	}
+
+	retired, err := NewKeySet(map[string][]byte{"new": []byte("new-secret")}, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if verifies(retired, oldToken) {
+		t.Fatal("expected a token signed with a removed key to be rejected")
+	}
+}
+
+func TestKeyfuncRejectsOtherAlgorithms(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicPath := writePublicPEM(t, "rsa.pub", &private.PublicKey)
+
+	ks, err := LoadKeySet(KeyConfig{Secret: "secret", PEMKeys: map[string]string{"rsa": publicPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the public key is no secret, so an HS256 token "signed" with it must not verify
+	publicPEM, err := ioutil.ReadFile(publicPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.StandardClaims{Subject: "ann"})
+	token.Header["kid"] = "rsa"
+
+	forged, err := token.SignedString(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if verifies(ks, forged) {
+		t.Fatal("expected an HS256 token with an RSA kid to be rejected")
+	}
+
+	_, err = jwt.Parse(forged, ks.Keyfunc)
+	if vErr, ok := err.(*jwt.ValidationError); !ok || !strings.Contains(vErr.Inner.Error(), "signing method") {
+		t.Fatalf("expected a signing method error, got %v", err)
+	}
+
+	// and a token without a kid, or an unknown one, has no key at all
+	for _, kid := range []interface{}{nil, "missing"} {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.StandardClaims{Subject: "ann"})
+		token.Header["kid"] = kid
+
+		signed, err := token.SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if verifies(ks, signed) {
+			t.Fatalf("expected a token with kid %v to be rejected", kid)
+		}
+	}
+}
+
+func TestLoadPEM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaPath := writePEM(t, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	ecPath := writePEM(t, "ec.pem", "EC PRIVATE KEY", ecDER)
+
+	for kid, path := range map[string]string{"rsa": rsaPath, "ec": ecPath} {
+		signer, err := LoadKeySet(KeyConfig{PEMKeys: map[string]string{kid: path}, SigningKID: kid})
+		if err != nil {
+			t.Fatalf("%s: %v", kid, err)
+		}
+
+		token := sign(t, signer)
+
+		// services which only have the public key can verify the token too
+		var public interface{} = &rsaKey.PublicKey
+		if kid == "ec" {
+			public = &ecKey.PublicKey
+		}
+
+		verifier, err := LoadKeySet(KeyConfig{Secret: "secret", PEMKeys: map[string]string{kid: writePublicPEM(t, kid+".pub", public)}})
+		if err != nil {
+			t.Fatalf("%s: %v", kid, err)
+		}
+
+		if !verifies(verifier, token) {
+			t.Fatalf("%s: expected the public key to verify a token of the private key", kid)
+		}
+	}
+
+	if alg := mustLoad(t, KeyConfig{PEMKeys: map[string]string{"ec": ecPath}, SigningKID: "ec"}).keys["ec"].method.Alg(); alg != "ES384" {
+		t.Fatalf("expected a P-384 key to use ES384, got %s", alg)
+	}
+
+	// a public key can't sign, and a file without a key isn't one
+	invalid := []KeyConfig{
+		{Secret: "secret", PEMKeys: map[string]string{"rsa": writePublicPEM(t, "rsa.pub", &rsaKey.PublicKey)}, SigningKID: "rsa"},
+		{PEMKeys: map[string]string{"junk": writeFile(t, "junk.pem", []byte("not a key"))}, SigningKID: "junk"},
+		{PEMKeys: map[string]string{"missing": filepath.Join(t.TempDir(), "missing.pem")}, SigningKID: "missing"},
+	}
+
+	for i, cfg := range invalid {
+		if _, err := LoadKeySet(cfg); err == nil {
+			t.Errorf("config %d: expected an error", i)
+		}
+	}
+}
+
+// mustLoad loads cfg, failing the test on errors
+func mustLoad(t *testing.T, cfg KeyConfig) *KeySet {
+	t.Helper()
+
+	ks, err := LoadKeySet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ks
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := NewKeySet(map[string][]byte{"hmac": []byte("secret")}, "hmac")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.add("rsa", &key{method: jwt.SigningMethodRS256, signKey: rsaKey, verifyKey: &rsaKey.PublicKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	// coordinates with leading zero bytes still have the full length of the curve
+	small := []struct {
+		kid   string
+		curve elliptic.Curve
+		size  int
+	}{
+		{"p256", elliptic.P256(), 32},
+		{"p521", elliptic.P521(), 66},
+	}
+
+	for _, s := range small {
+		public := &ecdsa.PublicKey{Curve: s.curve, X: big.NewInt(1), Y: big.NewInt(258)}
+		method, err := ecdsaMethod(public)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ks.add(s.kid, &key{method: method, verifyKey: public}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	set := ks.JWKS()
+
+	kids := []string{}
+	for _, jwk := range set.Keys {
+		kids = append(kids, jwk.Kid)
+	}
+
+	if strings.Join(kids, ",") != "p256,p521,rsa" {
+		t.Fatalf("expected only the public keys in kid order, got %v", kids)
+	}
+
+	for i, s := range small {
+		jwk := set.Keys[i]
+
+		x := decodeBase64URL(t, jwk.X)
+		y := decodeBase64URL(t, jwk.Y)
+
+		if jwk.Kty != "EC" || jwk.Crv != s.curve.Params().Name || jwk.Use != "sig" {
+			t.Fatalf("unexpected jwk %+v", jwk)
+		}
+
+		if len(x) != s.size || len(y) != s.size || x[s.size-1] != 1 || y[s.size-2] != 1 || y[s.size-1] != 2 {
+			t.Fatalf("%s: expected %d byte coordinates, got x %x y %x", s.kid, s.size, x, y)
+		}
+	}
+
+	if alg := set.Keys[1].Alg; alg != "ES512" {
+		t.Fatalf("expected P-521 to use ES512, got %s", alg)
+	}
+
+	rsaJWK := set.Keys[2]
+	n := new(big.Int).SetBytes(decodeBase64URL(t, rsaJWK.N))
+
+	if rsaJWK.Kty != "RSA" || rsaJWK.Alg != "RS256" || rsaJWK.E != "AQAB" || n.Cmp(rsaKey.N) != 0 {
+		t.Fatalf("unexpected rsa jwk %+v", rsaJWK)
+	}
+}
+
+// decodeBase64URL decodes unpadded base64url, failing the test if it isn't
+func decodeBase64URL(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("decoding %q: %v", s, err)
+	}
+
+	return b
+}
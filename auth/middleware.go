@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Maxbrain0/echo_mongo/apierror"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// ContextKey is where the middleware stores the verified *Principal in the echo context
+const ContextKey = "user"
+
+// CookieName is the cookie Login stores the token in
+const CookieName = "token"
+
+// RefreshCookieName is the cookie Login stores the refresh token in
+const RefreshCookieName = "refreshToken"
+
+// bearerPrefix starts the Authorization header of API and mobile clients
+const bearerPrefix = "Bearer "
+
+// BearerToken returns the token of an "Authorization: Bearer" header, or "" without one
+func BearerToken(c echo.Context) string {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	if len(header) > len(bearerPrefix) && strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return strings.TrimSpace(header[len(bearerPrefix):])
+	}
+
+	return ""
+}
+
+// JWT returns middleware which verifies the token against ks. The token is read from an
+// Authorization: Bearer header if there is one, and from the token cookie otherwise. Unlike echo's
+// JWT middleware, which only accepts a single algorithm, each key is checked with its own algorithm,
+// so HS256, RS256, and ES256 keys can be active at the same time
+func JWT(ks *KeySet) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			raw := requestToken(c)
+
+			if raw == "" {
+				return apierror.ErrMissingToken
+			}
+
+			principal, err := verify(ks, raw)
+			if err != nil {
+				return err
+			}
+
+			c.Set(ContextKey, principal)
+
+			return next(c)
+		}
+	}
+}
+
+// OptionalJWT returns middleware for routes open to everyone, which show logged in users more. A
+// valid token stores its Principal like JWT does, while requests with a missing or bad token carry on
+// without one
+func OptionalJWT(ks *KeySet) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if raw := requestToken(c); raw != "" {
+				if principal, err := verify(ks, raw); err == nil {
+					c.Set(ContextKey, principal)
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// requestToken reads the token from the Authorization: Bearer header, or the token cookie
+func requestToken(c echo.Context) string {
+	if raw := BearerToken(c); raw != "" {
+		return raw
+	}
+
+	if cookie, err := c.Cookie(CookieName); err == nil {
+		return cookie.Value
+	}
+
+	return ""
+}
+
+// verify checks raw against ks and returns the Principal of its claims
+func verify(ks *KeySet, raw string) (*Principal, error) {
+	claims := &Claims{}
+
+	token, err := jwt.ParseWithClaims(raw, claims, ks.Keyfunc)
+	if err != nil || !token.Valid {
+		return nil, apierror.ErrInvalidToken.WithMessage(jwtErrorMessage(err)).WithInternal(err)
+	}
+
+	return claims.Principal(), nil
+}
+
+// jwtErrorMessage explains why a token was rejected, without echoing back any of its contents
+func jwtErrorMessage(err error) string {
+	vErr, ok := err.(*jwt.ValidationError)
+	if !ok {
+		return "invalid jwt"
+	}
+
+	switch {
+	case vErr.Errors&jwt.ValidationErrorMalformed != 0:
+		// claims of the wrong json type fail before Claims.Valid sees them, ie a numeric userId
+		if typeErr, ok := vErr.Inner.(*json.UnmarshalTypeError); ok && typeErr.Field != "" {
+			return "invalid jwt: " + typeErr.Field + " claim has the wrong type"
+		}
+
+		return "malformed jwt"
+	case vErr.Errors&jwt.ValidationErrorExpired != 0:
+		return "jwt has expired"
+	case vErr.Errors&(jwt.ValidationErrorUnverifiable|jwt.ValidationErrorSignatureInvalid) != 0:
+		return "jwt signature could not be verified"
+	case vErr.Errors&jwt.ValidationErrorClaimsInvalid != 0 && vErr.Inner != nil:
+		return "invalid jwt: " + vErr.Inner.Error()
+	}
+
+	return "invalid jwt"
+}
+
+// PrincipalFrom returns the Principal stored by the JWT middleware, if there is one
+func PrincipalFrom(c echo.Context) (*Principal, bool) {
+	principal, ok := c.Get(ContextKey).(*Principal)
+
+	return principal, ok && principal != nil
+}
+
+// CSRF returns echo's CSRF middleware, limited to requests which authenticate with cookies. Browsers
+// attach cookies to cross-site requests, but never an Authorization header, so bearer requests are
+// skipped, as are unsafe requests without our token cookies (ie, logging in). Clients using cookies
+// read the _csrf cookie, which is set on every GET, and send it back in the X-CSRF-Token header.
+// Echo rejects a missing header with a 400, but to clients it is the same as a wrong one, so both
+// get a 403
+func CSRF() echo.MiddlewareFunc {
+	csrf := middleware.CSRFWithConfig(middleware.CSRFConfig{
+		CookiePath: "/",
+		Skipper: func(c echo.Context) bool {
+			if BearerToken(c) != "" {
+				return true
+			}
+
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				return false
+			}
+
+			return !hasCookie(c, CookieName) && !hasCookie(c, RefreshCookieName)
+		},
+	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// errors of next are passed on as they are, only the check's own are replaced
+			checked := false
+
+			err := csrf(func(c echo.Context) error {
+				checked = true
+				return next(c)
+			})(c)
+
+			if err != nil && !checked {
+				return apierror.ErrInvalidCSRFToken.WithInternal(err)
+			}
+
+			return err
+		}
+	}
+}
+
+// hasCookie reports whether the request carries a non-empty cookie called name
+func hasCookie(c echo.Context, name string) bool {
+	cookie, err := c.Cookie(name)
+
+	return err == nil && cookie.Value != ""
+}
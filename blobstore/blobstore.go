@@ -0,0 +1,49 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotExist is returned when an object with the requested key cannot be found in a Store
+var ErrNotExist = errors.New("blobstore: object does not exist")
+
+// ErrInvalidKey is returned for keys which are empty or could escape the store (ie, contain path separators)
+var ErrInvalidKey = errors.New("blobstore: invalid object key")
+
+// Object describes a stored object as returned by Store.List
+type Object struct {
+	Key     string
+	Updated time.Time
+}
+
+// Store is a minimal blob storage abstraction used for uploaded post images. Implementations
+// exist for Google Cloud Storage, the local filesystem, and memory (handy for dev and CI)
+type Store interface {
+	// Put writes the contents of r to the object named key, replacing any existing object
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Delete removes the object named key, returning ErrNotExist if there is no such object
+	Delete(ctx context.Context, key string) error
+	// PublicURL returns the url at which clients can download the object named key
+	PublicURL(key string) string
+	// Open returns a reader for the object named key. The caller must close the reader
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// List returns every object in the store
+	List(ctx context.Context) ([]Object, error)
+	// Check returns an error if the store can't be reached, ie for readiness checks
+	Check(ctx context.Context) error
+	// Close releases the connections of the store. It must not be used afterwards
+	Close() error
+}
+
+// validKey makes sure a key can be safely used as a single file or object name
+func validKey(key string) bool {
+	if key == "" || key == "." || key == ".." {
+		return false
+	}
+
+	return !strings.ContainsAny(key, "/\\\x00")
+}
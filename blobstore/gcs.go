@@ -0,0 +1,103 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// gcsBaseURL is the public endpoint for objects in Google Cloud Storage buckets
+const gcsBaseURL = "https://storage.googleapis.com/"
+
+// GCS stores objects in a Google Cloud Storage bucket
+type GCS struct {
+	Client *storage.Client
+	Bucket string
+}
+
+// NewGCS returns a Store backed by the provided bucket
+func NewGCS(client *storage.Client, bucket string) *GCS {
+	return &GCS{Client: client, Bucket: bucket}
+}
+
+// Put uploads r to the bucket under key
+func (g *GCS) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	wc := g.Client.Bucket(g.Bucket).Object(key).NewWriter(ctx)
+	wc.ContentType = contentType
+
+	if _, err := io.Copy(wc, r); err != nil {
+		wc.Close()
+		return err
+	}
+
+	return wc.Close()
+}
+
+// Delete removes key from the bucket
+func (g *GCS) Delete(ctx context.Context, key string) error {
+	err := g.Client.Bucket(g.Bucket).Object(key).Delete(ctx)
+
+	if err == storage.ErrObjectNotExist {
+		return ErrNotExist
+	}
+
+	return err
+}
+
+// PublicURL returns the googleapis url of key in the bucket
+func (g *GCS) PublicURL(key string) string {
+	return gcsBaseURL + g.Bucket + "/" + key
+}
+
+// Open returns a reader for key in the bucket
+func (g *GCS) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := g.Client.Bucket(g.Bucket).Object(key).NewReader(ctx)
+
+	if err == storage.ErrObjectNotExist {
+		return nil, ErrNotExist
+	}
+
+	return rc, err
+}
+
+// List iterates over all objects in the bucket
+func (g *GCS) List(ctx context.Context) ([]Object, error) {
+	objects := []Object{}
+	it := g.Client.Bucket(g.Bucket).Objects(ctx, nil)
+
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, Object{Key: attrs.Name, Updated: attrs.Updated})
+	}
+
+	return objects, nil
+}
+
+// Check lists at most one object, which needs the same permission as List
+func (g *GCS) Check(ctx context.Context) error {
+	_, err := g.Client.Bucket(g.Bucket).Objects(ctx, nil).Next()
+	if err == iterator.Done {
+		return nil
+	}
+
+	return err
+}
+
+// Close closes the Google Cloud Storage client
+func (g *GCS) Close() error {
+	return g.Client.Close()
+}
@@ -0,0 +1,138 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores objects as files in a single directory on disk
+type Local struct {
+	Dir     string
+	BaseURL string
+}
+
+// NewLocal returns a Store writing to dir, creating the directory if needed. Public urls are
+// built by appending the object key to baseURL
+func NewLocal(dir string, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Local{Dir: dir, BaseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+// Put writes r to a file named key. The data is written to a temporary file first so readers
+// never observe a partially written object
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	tmp, err := ioutil.TempFile(l.Dir, ".upload-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(l.Dir, key))
+}
+
+// Delete removes the file named key
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	err := os.Remove(filepath.Join(l.Dir, key))
+
+	if os.IsNotExist(err) {
+		return ErrNotExist
+	}
+
+	return err
+}
+
+// PublicURL returns BaseURL joined with the escaped key
+func (l *Local) PublicURL(key string) string {
+	return l.BaseURL + "/" + url.PathEscape(key)
+}
+
+// Open opens the file named key for reading
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	f, err := os.Open(filepath.Join(l.Dir, key))
+
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+
+	return f, err
+}
+
+// List returns the files in Dir, skipping hidden files such as in-progress uploads
+func (l *Local) List(ctx context.Context) ([]Object, error) {
+	infos, err := ioutil.ReadDir(l.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []Object{}
+
+	for _, info := range infos {
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+
+		objects = append(objects, Object{Key: info.Name(), Updated: info.ModTime()})
+	}
+
+	return objects, nil
+}
+
+// Check makes sure the directory still exists
+func (l *Local) Check(ctx context.Context) error {
+	info, err := os.Stat(l.Dir)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("blobstore: %s is not a directory", l.Dir)
+	}
+
+	return nil
+}
+
+// Close does nothing, since files are closed after each operation
+func (l *Local) Close() error {
+	return nil
+}
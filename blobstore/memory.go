@@ -0,0 +1,108 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps objects in a map. Nothing is persisted, so it is only meant for development and tests
+type Memory struct {
+	BaseURL string
+
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data    []byte
+	updated time.Time
+}
+
+// NewMemory returns an empty in-memory Store. Public urls are built by appending the object key to baseURL
+func NewMemory(baseURL string) *Memory {
+	return &Memory{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		objects: make(map[string]memoryObject),
+	}
+}
+
+// Put reads all of r and stores it under key
+func (m *Memory) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[key] = memoryObject{data: data, updated: time.Now()}
+
+	return nil
+}
+
+// Delete removes key from the map
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.objects[key]; !ok {
+		return ErrNotExist
+	}
+
+	delete(m.objects, key)
+
+	return nil
+}
+
+// PublicURL returns BaseURL joined with the escaped key
+func (m *Memory) PublicURL(key string) string {
+	return m.BaseURL + "/" + url.PathEscape(key)
+}
+
+// Open returns a reader over a snapshot of the object's data
+func (m *Memory) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+// List returns all keys in the map
+func (m *Memory) List(ctx context.Context) ([]Object, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	objects := make([]Object, 0, len(m.objects))
+
+	for key, obj := range m.objects {
+		objects = append(objects, Object{Key: key, Updated: obj.updated})
+	}
+
+	return objects, nil
+}
+
+// Check always succeeds, since memory can't be unreachable
+func (m *Memory) Check(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing. The images stay in memory until the process exits
+func (m *Memory) Close() error {
+	return nil
+}
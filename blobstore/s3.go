@@ -0,0 +1,191 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio-go/v6/pkg/credentials"
+)
+
+// s3PartSize is used for uploads of unknown length, so the client buffers 16 MB at a time rather
+// than sizing parts for a maximum-sized object
+const s3PartSize = 1024 * 1024 * 16
+
+// S3Config holds the settings needed to connect to AWS S3 or an S3-compatible server such as MinIO
+type S3Config struct {
+	// Endpoint is the host (and optional port) of the S3 api, ie s3.amazonaws.com or localhost:9000
+	Endpoint string
+	Region   string
+	Bucket   string
+	// AccessKey and SecretKey are optional. When empty, credentials are read from the AWS_* or
+	// MINIO_* environment variables, or from the EC2/ECS instance role
+	AccessKey string
+	SecretKey string
+	Secure    bool
+	// PathStyle requests urls like endpoint/bucket/key instead of bucket.endpoint/key. MinIO needs this
+	PathStyle bool
+	// URLTemplate builds public urls, with {bucket} and {key} replaced by the bucket and escaped object
+	// key. When empty, urls point directly at the endpoint
+	URLTemplate string
+}
+
+// S3 stores objects in an S3 bucket
+type S3 struct {
+	Client      *minio.Client
+	Bucket      string
+	URLTemplate string
+}
+
+// NewS3 creates a client for the configured endpoint and returns a Store backed by the bucket
+func NewS3(cfg S3Config) (*S3, error) {
+	var creds *credentials.Credentials
+
+	if cfg.AccessKey != "" {
+		creds = credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, "")
+	} else {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.IAM{},
+		})
+	}
+
+	lookup := minio.BucketLookupAuto
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.NewWithOptions(cfg.Endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       cfg.Secure,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	template := cfg.URLTemplate
+	if template == "" {
+		scheme := "http://"
+		if cfg.Secure {
+			scheme = "https://"
+		}
+
+		if cfg.PathStyle {
+			template = scheme + cfg.Endpoint + "/{bucket}/{key}"
+		} else {
+			template = scheme + "{bucket}." + cfg.Endpoint + "/{key}"
+		}
+	}
+
+	return &S3{Client: client, Bucket: cfg.Bucket, URLTemplate: template}, nil
+}
+
+// Put uploads r to the bucket under key
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	// multipart files can be measured up front, which avoids buffering the upload in parts
+	size := int64(-1)
+	if seeker, ok := r.(io.Seeker); ok {
+		if end, err := seeker.Seek(0, io.SeekEnd); err == nil {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+
+			size = end
+		}
+	}
+
+	_, err := s.Client.PutObjectWithContext(ctx, s.Bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    s3PartSize,
+	})
+
+	return err
+}
+
+// Delete removes key from the bucket. S3 does not report deletes of missing objects, so ErrNotExist
+// is never returned
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.Client.RemoveObject(s.Bucket, key)
+}
+
+// PublicURL fills in URLTemplate for key
+func (s *S3) PublicURL(key string) string {
+	return strings.NewReplacer("{bucket}", s.Bucket, "{key}", url.PathEscape(key)).Replace(s.URLTemplate)
+}
+
+// Open returns a reader for key in the bucket
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.Client.GetObjectWithContext(ctx, s.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// GetObject is lazy, so stat the object to find out whether it exists
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotExist
+		}
+
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// List returns all objects in the bucket
+func (s *S3) List(ctx context.Context) ([]Object, error) {
+	done := make(chan struct{})
+	defer close(done)
+
+	objects := []Object{}
+
+	for info := range s.Client.ListObjectsV2(s.Bucket, "", true, done) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, Object{Key: info.Key, Updated: info.LastModified})
+	}
+
+	return objects, nil
+}
+
+// Check makes sure the bucket exists
+func (s *S3) Check(ctx context.Context) error {
+	exists, err := s.Client.BucketExistsWithContext(ctx, s.Bucket)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("blobstore: bucket %q does not exist", s.Bucket)
+	}
+
+	return nil
+}
+
+// Close does nothing, since the S3 client holds no connections that need closing
+func (s *S3) Close() error {
+	return nil
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a config file into a temporary directory and returns its path
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load("test", []string{"-storage=memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Listen != ":1323" || cfg.DB.Name != "foodie" || cfg.DB.PostCollection != "posts" || cfg.Timeouts.DB != 10*time.Second {
+		t.Fatalf("unexpected defaults %+v", cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+listen: ":8000"
+db:
+  name: file-db
+  uri: mongodb://file
+storage:
+  backend: local
+  dir: /srv/images
+jwt:
+  pemKeys:
+    file: file.pem
+timeouts:
+  db: 3s
+`)
+
+	t.Setenv(FileEnv, path)
+	t.Setenv("DB_NAME", "env-db")
+	t.Setenv("DB_TIMEOUT", "4s")
+	t.Setenv("LISTEN_ADDR", ":9000")
+
+	cfg, err := Load("test", []string{"-listen=:7000", "-jwtpemkeys=flag=flag.pem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flags beat the environment, which beats the file, which beats the defaults
+	if cfg.Listen != ":7000" {
+		t.Errorf("expected the listen flag, got %q", cfg.Listen)
+	}
+
+	if cfg.DB.Name != "env-db" || cfg.Timeouts.DB != 4*time.Second {
+		t.Errorf("expected the environment, got %q %v", cfg.DB.Name, cfg.Timeouts.DB)
+	}
+
+	if cfg.DB.URI != "mongodb://file" || cfg.Storage.Backend != "local" || cfg.Storage.Dir != "/srv/images" {
+		t.Errorf("expected the file, got %+v %+v", cfg.DB, cfg.Storage)
+	}
+
+	if cfg.Storage.Route != "/uploads" || cfg.DB.UserCollection != "users" {
+		t.Errorf("expected defaults for unset values, got %+v %+v", cfg.DB, cfg.Storage)
+	}
+
+	if len(cfg.JWT.PEMKeys) != 1 || cfg.JWT.PEMKeys["flag"] != "flag.pem" {
+		t.Errorf("expected the pem keys flag to replace the file's keys, got %v", cfg.JWT.PEMKeys)
+	}
+}
+
+func TestLoadConfigFlag(t *testing.T) {
+	t.Setenv(FileEnv, writeFile(t, "listen: \":1\"\nstorage:\n  backend: memory\n"))
+	path := writeFile(t, "listen: \":2\"\nstorage:\n  backend: memory\n")
+
+	cfg, err := Load("test", []string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Listen != ":2" {
+		t.Fatalf("expected -config to override %s, got %q", FileEnv, cfg.Listen)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want []string
+	}{
+		{
+			name: "typo in file",
+			file: "storage:\n  backnd: memory\n",
+			want: []string{"backnd"},
+		},
+		{
+			name: "bad environment value",
+			env:  map[string]string{"DB_TIMEOUT": "soon"},
+			args: []string{"-storage=memory"},
+			want: []string{"DB_TIMEOUT"},
+		},
+		{
+			name: "every invalid setting is reported",
+			args: []string{"-storage=floppy", "-dbname=", "-dbtimeout=0", "-maximagesize=-1", "-pagesize=500", "-loglevel=loud", "-tracing=jaeger", "-tracingsampleratio=2", "-reconcile=maybe"},
+			want: []string{"storage backend", "db name", "db timeout", "max image size", "page size", "log level", "tracing exporter", "sample ratio", "reconcile mode"},
+		},
+		{
+			name: "gcs needs a bucket",
+			want: []string{"gcs needs a bucket"},
+		},
+		{
+			name: "production needs a key",
+			args: []string{"-storage=memory", "-production"},
+			want: []string{"production needs a jwt key"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(FileEnv, "")
+
+			if tt.file != "" {
+				t.Setenv(FileEnv, writeFile(t, tt.file))
+			}
+
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			_, err := Load("test", tt.args)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected %q in error %q", want, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FileEnv names the environment variable holding the config file path, which -config overrides
+const FileEnv = "CONFIG_FILE"
+
+// Load builds the configuration from the defaults, then the YAML config file, then environment
+// variables, then the command line flags in args. Each source overrides the ones before it, so a
+// flag always wins. The result is validated
+func Load(name string, args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(FileEnv), "The path of a YAML config file. Environment variables and flags override its settings. Defaults to the "+FileEnv+" environment variable")
+	envs := cfg.bind(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// flags have to be parsed to find the config file, but are applied last. Remember the given ones
+	given := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = f.Value.String()
+	})
+
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range sortedKeys(envs) {
+		if value, ok := os.LookupEnv(envs[name]); ok {
+			if err := fs.Set(name, value); err != nil {
+				return nil, fmt.Errorf("config: environment variable %s: %v", envs[name], err)
+			}
+		}
+	}
+
+	for name, value := range given {
+		if name != "config" {
+			fs.Set(name, value)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile reads the YAML file at path over the current settings. Unknown keys are an error, since
+// they are most likely typos
+func (c *Config) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("config: %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// bind registers a flag for each setting, and returns the environment variable of each flag by name
+func (c *Config) bind(fs *flag.FlagSet) map[string]string {
+	envs := map[string]string{}
+
+	str := func(p *string, name string, env string, usage string) {
+		fs.StringVar(p, name, *p, usage+envUsage(env))
+		envs[name] = env
+	}
+
+	boolean := func(p *bool, name string, env string, usage string) {
+		fs.BoolVar(p, name, *p, usage+envUsage(env))
+		envs[name] = env
+	}
+
+	str(&c.Listen, "listen", "LISTEN_ADDR", "The address the server listens on")
+	boolean(&c.Production, "production", "PRODUCTION", "Run in production mode, which refuses to start without a configured jwt key")
+
+	str(&c.DB.URI, "dburi", "DB_URI", "The db of the mongo URI. The default URI for a docker container is included.")
+	str(&c.DB.Name, "dbname", "DB_NAME", "The name of the mongo database")
+	str(&c.DB.UserCollection, "usercollection", "DB_USER_COLLECTION", "The name of the users collection")
+	str(&c.DB.PostCollection, "postcollection", "DB_POST_COLLECTION", "The name of the posts collection")
+	str(&c.DB.SessionCollection, "sessioncollection", "DB_SESSION_COLLECTION", "The name of the sessions collection")
+	boolean(&c.DB.Validators, "dbvalidators", "DB_VALIDATORS", "Set $jsonSchema validators on the users and posts collections on startup, so mongo rejects malformed documents")
+
+	str(&c.Storage.Backend, "storage", "STORAGE", "Where uploaded images are stored. One of gcs, s3, local, or memory. Use local or memory to run without cloud credentials")
+	str(&c.Storage.Dir, "storagedir", "STORAGE_DIR", "The directory uploaded images are written to when using local storage")
+	str(&c.Storage.URL, "storageurl", "STORAGE_URL", "The base URL for public image links when using local or memory storage. Defaults to -storageroute on this server")
+	str(&c.Storage.Route, "storageroute", "STORAGE_ROUTE", "The route this server uses to serve images when using local storage")
+	str(&c.Storage.GCS.Credentials, "gcconfig", "GCS_CREDENTIALS", "The path of the json config file for Google Cloud Storage. See https://cloud.google.com/storage/docs/reference/libraries#client-libraries-install-go for more information")
+	str(&c.Storage.GCS.Bucket, "gcbucket", "GCS_BUCKET", "The string-valued name of your google storage bucket")
+	str(&c.Storage.S3.Endpoint, "s3endpoint", "S3_ENDPOINT", "The host of the S3 api when using s3 storage. Use localhost:9000 for the MinIO container in docker-compose")
+	str(&c.Storage.S3.Region, "s3region", "S3_REGION", "The region of the S3 bucket")
+	str(&c.Storage.S3.Bucket, "s3bucket", "S3_BUCKET", "The name of the S3 bucket for storing images. Credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	boolean(&c.Storage.S3.Secure, "s3secure", "S3_SECURE", "Use https to connect to the S3 api")
+	boolean(&c.Storage.S3.PathStyle, "s3pathstyle", "S3_PATH_STYLE", "Use path-style (endpoint/bucket/key) instead of virtual-host-style addressing. Required by MinIO")
+	str(&c.Storage.S3.URLTemplate, "s3urltemplate", "S3_URL_TEMPLATE", "Template for public image URLs, ie https://cdn.example.com/{bucket}/{key}. Defaults to the S3 endpoint")
+
+	str(&c.JWT.Secret, "jwtsecret", "JWT_SECRET", "The secret used to sign login tokens")
+	str(&c.JWT.KeyFile, "jwtkeyfile", "JWT_KEY_FILE", "A file of kid:secret lines, one per key, used instead of -jwtsecret to allow key rotation")
+	fs.Var((*pemKeys)(&c.JWT.PEMKeys), "jwtpemkeys", "Comma separated kid=path pairs of RSA or ECDSA keys in PEM files. Private keys can sign tokens (RS256 or ES256), public keys only verify them"+envUsage("JWT_PEM_KEYS"))
+	envs["jwtpemkeys"] = "JWT_PEM_KEYS"
+	str(&c.JWT.SigningKey, "jwtsigningkey", "JWT_SIGNING_KEY", "The kid of the key used to sign new tokens. Defaults to the first key in -jwtkeyfile")
+
+	fs.Int64Var(&c.Uploads.MaxImageSize, "maximagesize", c.Uploads.MaxImageSize, "The largest image accepted, in bytes"+envUsage("MAX_IMAGE_SIZE"))
+	envs["maximagesize"] = "MAX_IMAGE_SIZE"
+
+	fs.Int64Var(&c.Pages.Size, "pagesize", c.Pages.Size, "The number of posts in a page of a list, unless the request gives a limit"+envUsage("PAGE_SIZE"))
+	fs.Int64Var(&c.Pages.MaxSize, "maxpagesize", c.Pages.MaxSize, "The largest limit a request for a list of posts may give"+envUsage("MAX_PAGE_SIZE"))
+	envs["pagesize"] = "PAGE_SIZE"
+	envs["maxpagesize"] = "MAX_PAGE_SIZE"
+
+	fs.DurationVar(&c.Timeouts.DB, "dbtimeout", c.Timeouts.DB, "How long database operations of a request may take"+envUsage("DB_TIMEOUT"))
+	fs.DurationVar(&c.Timeouts.Upload, "uploadtimeout", c.Timeouts.Upload, "How long requests which upload an image may take to store it and save their post"+envUsage("UPLOAD_TIMEOUT"))
+	fs.DurationVar(&c.Timeouts.Cleanup, "cleanuptimeout", c.Timeouts.Cleanup, "How long removing the image of a failed request may take"+envUsage("CLEANUP_TIMEOUT"))
+	fs.DurationVar(&c.Timeouts.Drain, "drain", c.Timeouts.Drain, "How long to keep serving after SIGTERM or Control C, with /readyz failing so load balancers stop sending requests. Set it above the readiness probe period of your orchestrator"+envUsage("DRAIN_PERIOD"))
+	fs.DurationVar(&c.Timeouts.Shutdown, "shutdowntimeout", c.Timeouts.Shutdown, "How long to wait for running requests on shutdown before cancelling them"+envUsage("SHUTDOWN_TIMEOUT"))
+	envs["dbtimeout"] = "DB_TIMEOUT"
+	envs["uploadtimeout"] = "UPLOAD_TIMEOUT"
+	envs["cleanuptimeout"] = "CLEANUP_TIMEOUT"
+	envs["drain"] = "DRAIN_PERIOD"
+	envs["shutdowntimeout"] = "SHUTDOWN_TIMEOUT"
+
+	str(&c.Log.Level, "loglevel", "LOG_LEVEL", "The least severe log lines written. One of debug, info, warn, or error")
+	str(&c.Log.Format, "logformat", "LOG_FORMAT", "How log lines are written. Use json for log collectors, or text to read them yourself")
+
+	str(&c.Tracing.Exporter, "tracing", "TRACING_EXPORTER", "Where request traces are sent. One of none, stdout (which prints them to stderr), or otlp")
+	str(&c.Tracing.Endpoint, "otlpendpoint", "OTLP_ENDPOINT", "The host:port of the OTLP/HTTP collector, ie localhost:4318. Defaults to OTEL_EXPORTER_OTLP_ENDPOINT or the exporter's default")
+	boolean(&c.Tracing.Insecure, "otlpinsecure", "OTLP_INSECURE", "Send traces to the collector over http instead of https")
+	str(&c.Tracing.ServiceName, "servicename", "SERVICE_NAME", "The name of this server in traces")
+	fs.Float64Var(&c.Tracing.SampleRatio, "tracingsampleratio", c.Tracing.SampleRatio, "The fraction of new traces which are recorded, between 0 and 1"+envUsage("TRACING_SAMPLE_RATIO"))
+	envs["tracingsampleratio"] = "TRACING_SAMPLE_RATIO"
+
+	// reconcile runs a one-off command, so it has no environment variable
+	fs.StringVar(&c.Reconcile.Mode, "reconcile", c.Reconcile.Mode, "Instead of serving, compare stored images with posts and exit. Use report to list orphaned images, or remove to also delete them")
+	fs.DurationVar(&c.Reconcile.MinAge, "reconcileminage", c.Reconcile.MinAge, "Images updated more recently than this are never treated as orphans, since their post may still be saving")
+
+	return envs
+}
+
+// envUsage mentions the environment variable of a flag in its usage
+func envUsage(env string) string {
+	return ". Can be set with the " + env + " environment variable"
+}
+
+// sortedKeys returns the keys of m in order, so settings are applied the same way every time
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// pemKeys is a flag.Value for comma separated kid=path pairs. Setting it replaces all pairs
+type pemKeys map[string]string
+
+func (p *pemKeys) String() string {
+	if p == nil {
+		return ""
+	}
+
+	pairs := []string{}
+	for _, kid := range sortedKeys(*p) {
+		pairs = append(pairs, kid+"="+(*p)[kid])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (p *pemKeys) Set(value string) error {
+	keys := map[string]string{}
+
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("jwt PEM key %q is not of the form kid=path", pair)
+		}
+
+		keys[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	*p = keys
+
+	return nil
+}
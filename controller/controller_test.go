@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/Maxbrain0/echo_mongo/apierror"
+	"github.com/Maxbrain0/echo_mongo/auth"
+	"github.com/Maxbrain0/echo_mongo/blobstore"
+	"github.com/Maxbrain0/echo_mongo/repository"
+	"github.com/Maxbrain0/echo_mongo/validation"
+	"github.com/labstack/echo/v4"
+)
+
+// testServer wires the controllers to in-memory users, posts, sessions, and images, with the same
+// routes and middleware as main.go, so the handlers can be tested without MongoDB or a bucket
+type testServer struct {
+	e     *echo.Echo
+	db    *repository.MemoryDB
+	store *blobstore.Memory
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	db := repository.NewMemoryDB()
+	store := blobstore.NewMemory("/uploads")
+	keys := auth.RandomKeySet()
+
+	users := &Users{UserRepo: db.Users(), SessionRepo: db.Sessions(), Keys: keys}
+	posts := &Posts{UserRepo: db.Users(), PostRepo: db.Posts(), Storage: store}
+
+	jwtmw := []echo.MiddlewareFunc{auth.JWT(keys), users.CheckSession}
+
+	e := echo.New()
+	e.Validator = validation.New()
+	e.HTTPErrorHandler = apierror.Handler
+	e.Use(auth.CSRF())
+	e.POST("/user", users.CreateUser)
+	e.POST("/login", users.Login)
+	e.POST("/refresh", users.Refresh)
+	e.POST("/logout", users.Logout)
+	e.GET("/posts", posts.GetPosts)
+	e.GET("/posts/:id", posts.GetPost, auth.OptionalJWT(keys), users.CheckOptionalSession)
+	e.GET("/admin/posts", posts.GetUserPosts, jwtmw...)
+	e.POST("/admin/post", posts.CreatePost, jwtmw...)
+	e.DELETE("/admin/post/:id", posts.DeletePost, jwtmw...)
+	e.PUT("/admin/post/:id", posts.EditPost, jwtmw...)
+	e.GET("/uploads/*", (&Images{Storage: store}).GetImage)
+
+	return &testServer{e: e, db: db, store: store}
+}
+
+// do sends a request, with token as a bearer token unless it is empty
+func (s *testServer) do(method string, path string, contentType string, body io.Reader, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, body)
+
+	if contentType != "" {
+		req.Header.Set(echo.HeaderContentType, contentType)
+	}
+
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// doJSON sends v as a json body
+func (s *testServer) doJSON(t *testing.T, method string, path string, v interface{}, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s.do(method, path, echo.MIMEApplicationJSON, bytes.NewReader(body), token)
+}
+
+// signup creates a user and logs in, returning the access token
+func (s *testServer) signup(t *testing.T, userName string) string {
+	t.Helper()
+
+	creds := map[string]string{"userName": userName, "password": "secret-" + userName}
+
+	if rec := s.doJSON(t, http.MethodPost, "/user", creds, ""); rec.Code != http.StatusCreated {
+		t.Fatalf("creating user %s: got %d %s", userName, rec.Code, rec.Body)
+	}
+
+	rec := s.doJSON(t, http.MethodPost, "/login?returnTokens=true", creds, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("logging in %s: got %d %s", userName, rec.Code, rec.Body)
+	}
+
+	tokens := &tokenResponse{}
+	decode(t, rec, tokens)
+
+	return tokens.AccessToken
+}
+
+// objectCount returns the number of stored images
+func (s *testServer) objectCount(t *testing.T) int {
+	t.Helper()
+
+	objects, err := s.store.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(objects)
+}
+
+// testFile is a file part of a multipart form
+type testFile struct {
+	name        string
+	contentType string
+	data        []byte
+}
+
+// pngFile returns a small file which claims to be a png
+func pngFile(name string) *testFile {
+	return &testFile{name: name, contentType: "image/png", data: []byte("\x89PNG\r\n\x1a\n" + name)}
+}
+
+// multipartForm encodes fields, and file as the image field if it is set
+func multipartForm(t *testing.T, fields map[string]string, file *testFile) (string, io.Reader) {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+
+	for name, value := range fields {
+		if err := w.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if file != nil {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="image"; filename="`+file.name+`"`)
+		header.Set("Content-Type", file.contentType)
+
+		part, err := w.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := part.Write(file.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return w.FormDataContentType(), body
+}
+
+// decode reads the json response body into v
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+}
+
+// expectStatus fails the test unless the response has status code
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, code int) {
+	t.Helper()
+
+	if rec.Code != code {
+		t.Fatalf("expected status %d, got %d: %s", code, rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+}
+
+// errorResponse is an apierror.Response with the details of a validation error
+type errorResponse struct {
+	Code      apierror.Code            `json:"code"`
+	Message   string                   `json:"message"`
+	Details   []*validation.FieldError `json:"details"`
+	RequestID string                   `json:"requestId"`
+}
+
+// expectError fails unless rec is an error response with status and code
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, status int, code apierror.Code) *errorResponse {
+	t.Helper()
+	expectStatus(t, rec, status)
+
+	resp := &errorResponse{}
+	decode(t, rec, resp)
+
+	if resp.Code != code {
+		t.Fatalf("expected error code %s, got %+v", code, resp)
+	}
+
+	return resp
+}
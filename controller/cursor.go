@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"encoding/base64"
+
+	"github.com/Maxbrain0/echo_mongo/apierror"
+	"github.com/Maxbrain0/echo_mongo/model"
+	"github.com/Maxbrain0/echo_mongo/repository"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Cursors are opaque to clients: a direction and the id of the post a page continues from, in
+// base64. Ids are used rather than createdAt since ObjectIDs start with their creation time, are
+// unique, and are set on posts saved before createdAt existed
+const (
+	cursorAfter  byte = 'a'
+	cursorBefore byte = 'b'
+)
+
+// DefaultPageSize is used when Posts.PageSize isn't set
+const DefaultPageSize = 20
+
+// DefaultMaxPageSize is used when Posts.MaxPageSize isn't set
+const DefaultMaxPageSize = 100
+
+// encodeCursor returns the cursor of the page after or before the post with id
+func encodeCursor(direction byte, id primitive.ObjectID) string {
+	return base64.RawURLEncoding.EncodeToString(append([]byte{direction}, id[:]...))
+}
+
+// decodeCursor sets the After or Before of page from cursor
+func decodeCursor(cursor string, page *repository.Page) error {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) != 1+len(primitive.ObjectID{}) {
+		return apierror.ErrInvalidCursor
+	}
+
+	var id primitive.ObjectID
+	copy(id[:], b[1:])
+
+	switch b[0] {
+	case cursorAfter:
+		page.After = id
+	case cursorBefore:
+		page.Before = id
+	default:
+		return apierror.ErrInvalidCursor
+	}
+
+	return nil
+}
+
+// listParams reads the limit, skip, and cursor of a request for a list of posts. The limit defaults
+// to the page size and is capped at the max page size. The returned page asks for one post more than
+// the limit, which tells setPage whether there are more
+func (posts *Posts) listParams(c echo.Context) (*model.PostList, repository.Page, error) {
+	params := new(model.PostList)
+
+	if err := c.Bind(params); err != nil {
+		return nil, repository.Page{}, err
+	}
+
+	if params.Limit < 0 || params.Skip < 0 {
+		return nil, repository.Page{}, apierror.ErrBadRequest.WithMessage("limit and skip must not be negative")
+	}
+
+	if params.Cursor != "" && params.Skip > 0 {
+		return nil, repository.Page{}, apierror.ErrBadRequest.WithMessage("Please use either cursor or skip, not both")
+	}
+
+	size, maxSize := posts.PageSize, posts.MaxPageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+
+	if maxSize <= 0 {
+		maxSize = DefaultMaxPageSize
+	}
+
+	if params.Limit == 0 {
+		params.Limit = size
+	}
+
+	if params.Limit > maxSize {
+		params.Limit = maxSize
+	}
+
+	page := repository.Page{Limit: params.Limit + 1, Skip: params.Skip}
+
+	if params.Cursor != "" {
+		if err := decodeCursor(params.Cursor, &page); err != nil {
+			return nil, repository.Page{}, err
+		}
+	}
+
+	return params, page, nil
+}
+
+// setPage puts the posts found for page into list, dropping the extra post asked for by listParams,
+// and sets the cursors of the pages after and before
+func setPage(list *model.PostList, page repository.Page, found []*model.Post) {
+	backwards := !page.Before.IsZero()
+	more := int64(len(found)) > list.Limit
+
+	// the extra post is the one furthest from where the page started
+	if more && backwards {
+		found = found[1:]
+	} else if more {
+		found = found[:list.Limit]
+	}
+
+	list.Posts = found
+
+	if len(found) == 0 {
+		return
+	}
+
+	// reading forwards, there are posts before unless the page started at the beginning. Reading
+	// backwards, the page started right before a post
+	hasNext, hasPrev := more, !page.After.IsZero() || page.Skip > 0
+	if backwards {
+		hasNext, hasPrev = true, more
+	}
+
+	if hasNext {
+		list.NextCursor = encodeCursor(cursorAfter, found[len(found)-1].ID)
+	}
+
+	if hasPrev {
+		list.PrevCursor = encodeCursor(cursorBefore, found[0].ID)
+	}
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/logging"
+	"github.com/labstack/echo/v4"
+)
+
+// Check tests whether a dependency is usable, returning nil if it is
+type Check func(ctx context.Context) error
+
+// Health serves the liveness and readiness routes for orchestrators and load balancers
+type Health struct {
+	// Checks are the dependencies which must be reachable before we take traffic, by name
+	Checks map[string]Check
+	// Timeout limits each check. Defaults to 2 seconds
+	Timeout time.Duration
+	// Logger receives the errors of failed checks, which aren't sent. Defaults to slog.Default
+	Logger *slog.Logger
+
+	// draining is set once the server is shutting down
+	draining atomic.Bool
+}
+
+// Drain makes the readiness check fail from now on, so load balancers stop sending requests
+// before the server stops accepting them. Liveness is unaffected
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// checkResult is the outcome of a single readiness check
+type checkResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+}
+
+// healthResponse is the body of both health routes
+type healthResponse struct {
+	Status string                  `json:"status"`
+	Checks map[string]*checkResult `json:"checks,omitempty"`
+}
+
+// Healthz reports that the process is up and serving requests. It checks no dependencies, so an
+// unreachable database doesn't get the process restarted
+func (h *Health) Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, &healthResponse{Status: "ok"})
+}
+
+// Readyz runs every check at once, and responds 200 if they all pass or 503 if any failed, with the
+// status of each check. The route is public, so why a check failed is only logged, since errors
+// name hosts and buckets. While draining it responds 503 without running the checks
+func (h *Health) Readyz(c echo.Context) error {
+	if h.draining.Load() {
+		return c.JSON(http.StatusServiceUnavailable, &healthResponse{Status: "draining"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), orDefault(h.Timeout, 2*time.Second))
+	defer cancel()
+
+	resp := &healthResponse{Status: "ok", Checks: map[string]*checkResult{}}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, check := range h.Checks {
+		wg.Add(1)
+
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check(ctx)
+			result := &checkResult{Status: "ok", Duration: time.Since(start).String()}
+
+			if err != nil {
+				result.Status = "unavailable"
+				logging.ForRequest(h.Logger, c).Warn("readiness check failed", "check", name, "error", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			resp.Checks[name] = result
+			if err != nil {
+				resp.Status = "unavailable"
+			}
+		}(name, check)
+	}
+
+	wg.Wait()
+
+	if resp.Status != "ok" {
+		return c.JSON(http.StatusServiceUnavailable, resp)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
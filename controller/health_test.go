@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// serveHealth calls handler of h with a GET request
+func serveHealth(h *Health, handler func(*Health, echo.Context) error) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+	if err := handler(h, c); err != nil {
+		panic(err)
+	}
+
+	return rec
+}
+
+func TestHealthz(t *testing.T) {
+	h := &Health{Checks: map[string]Check{
+		"mongo": func(ctx context.Context) error { return errors.New("down") },
+	}}
+
+	// liveness ignores dependencies
+	expectStatus(t, serveHealth(h, (*Health).Healthz), http.StatusOK)
+}
+
+func TestReadyz(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	t.Run("ready", func(t *testing.T) {
+		rec := serveHealth(&Health{Checks: map[string]Check{"mongo": ok, "storage": ok}}, (*Health).Readyz)
+		expectStatus(t, rec, http.StatusOK)
+
+		resp := &healthResponse{}
+		decode(t, rec, resp)
+
+		if resp.Status != "ok" || len(resp.Checks) != 2 || resp.Checks["storage"].Status != "ok" {
+			t.Fatalf("unexpected response %+v", resp)
+		}
+	})
+
+	t.Run("dependency down", func(t *testing.T) {
+		rec := serveHealth(&Health{Checks: map[string]Check{"mongo": ok, "storage": down}}, (*Health).Readyz)
+		expectStatus(t, rec, http.StatusServiceUnavailable)
+
+		resp := &healthResponse{}
+		decode(t, rec, resp)
+
+		if resp.Checks["mongo"].Status != "ok" || resp.Checks["storage"].Status != "unavailable" {
+			t.Fatalf("expected the failing check to be reported, got %+v %+v", resp.Checks["mongo"], resp.Checks["storage"])
+		}
+
+		if strings.Contains(rec.Body.String(), "connection refused") {
+			t.Fatalf("the error of a check must not be sent: %s", rec.Body.String())
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		start := time.Now()
+		rec := serveHealth(&Health{Checks: map[string]Check{"mongo": slow}, Timeout: 50 * time.Millisecond}, (*Health).Readyz)
+		expectStatus(t, rec, http.StatusServiceUnavailable)
+
+		if time.Since(start) > time.Second {
+			t.Fatal("readiness should give up after its timeout")
+		}
+	})
+
+	t.Run("draining", func(t *testing.T) {
+		h := &Health{Checks: map[string]Check{"mongo": ok}}
+		h.Drain()
+
+		rec := serveHealth(h, (*Health).Readyz)
+		expectStatus(t, rec, http.StatusServiceUnavailable)
+
+		resp := &healthResponse{}
+		decode(t, rec, resp)
+
+		if resp.Status != "draining" {
+			t.Fatalf("expected draining, got %+v", resp)
+		}
+
+		// still alive while draining
+		expectStatus(t, serveHealth(h, (*Health).Healthz), http.StatusOK)
+	})
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/apierror"
+	"github.com/Maxbrain0/echo_mongo/blobstore"
+	"github.com/Maxbrain0/echo_mongo/model"
+	"github.com/labstack/echo/v4"
+)
+
+// Images serves uploaded images from storage backends without a web server of their own, ie local
+// disk or memory. Images share an origin with the api and its cookies, so they are served as inert files
+type Images struct {
+	Storage blobstore.Store
+}
+
+// imageContentTypes maps the extensions storeImage gives images back to their types
+var imageContentTypes = map[string]string{}
+
+func init() {
+	for contentType, ext := range model.ImageExtensions {
+		imageContentTypes[ext] = contentType
+	}
+}
+
+// GetImage serves the image whose key is the rest of the path. Browsers are told not to guess its
+// type, and never to run it as a page or script, even if it is opened directly
+func (images *Images) GetImage(c echo.Context) error {
+	key, err := url.PathUnescape(c.Param("*"))
+	if err != nil {
+		return apierror.ErrNotFound
+	}
+
+	r, err := images.Storage.Open(c.Request().Context(), key)
+	if err == blobstore.ErrNotExist || err == blobstore.ErrInvalidKey {
+		return apierror.ErrNotFound
+	}
+
+	if err != nil {
+		return apierror.Internal("Could not load image", err)
+	}
+
+	defer r.Close()
+
+	contentType, ok := imageContentTypes[path.Ext(key)]
+	if !ok {
+		contentType = echo.MIMEOctetStream
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, contentType)
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	header.Set(echo.HeaderContentSecurityPolicy, "default-src 'none'; sandbox")
+
+	// files support range and conditional requests
+	if rs, ok := r.(io.ReadSeeker); ok {
+		http.ServeContent(c.Response(), c.Request(), key, time.Time{}, rs)
+		return nil
+	}
+
+	return c.Stream(http.StatusOK, contentType, r)
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Maxbrain0/echo_mongo/apierror"
+	"github.com/Maxbrain0/echo_mongo/blobstore"
+	"github.com/labstack/echo/v4"
+)
+
+func TestGetImage(t *testing.T) {
+	store, err := blobstore.NewLocal(t.TempDir(), "/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	png := pngFile("soup.png").data
+	if err := store.Put(context.Background(), "soup.png", bytes.NewReader(png), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = apierror.Handler
+	e.GET("/uploads/*", (&Images{Storage: store}).GetImage)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return rec
+	}
+
+	rec := get("/uploads/soup.png")
+	expectStatus(t, rec, http.StatusOK)
+
+	if rec.Body.String() != string(png) {
+		t.Fatalf("unexpected image %q", rec.Body.String())
+	}
+
+	header := rec.Header()
+	if header.Get(echo.HeaderContentType) != "image/png" || header.Get(echo.HeaderXContentTypeOptions) != "nosniff" || header.Get(echo.HeaderContentSecurityPolicy) == "" {
+		t.Fatalf("expected inert image headers, got %v", header)
+	}
+
+	expectError(t, get("/uploads/stew.png"), http.StatusNotFound, apierror.ErrNotFound.Code)
+	expectError(t, get("/uploads/..%2Fsecret"), http.StatusNotFound, apierror.ErrNotFound.Code)
+}
@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Maxbrain0/echo_mongo/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// Keys holds the jwt keys and is the receiver of endpoints which publish them
+type Keys struct {
+	KeySet *auth.KeySet
+}
+
+// JWKS returns the public keys used to sign login tokens, so other services can verify them
+func (keys *Keys) JWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+
+	return c.JSON(http.StatusOK, keys.KeySet.JWKS())
+}
@@ -2,265 +2,340 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"time"
 
-	"cloud.google.com/go/storage"
+	"github.com/Maxbrain0/echo_mongo/apierror"
+	"github.com/Maxbrain0/echo_mongo/blobstore"
+	"github.com/Maxbrain0/echo_mongo/logging"
 	"github.com/Maxbrain0/echo_mongo/model"
+	"github.com/Maxbrain0/echo_mongo/repository"
 	"github.com/Maxbrain0/echo_mongo/util"
-	"github.com/google/uuid"
+	"github.com/Maxbrain0/echo_mongo/validation"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// Posts holds reference to a database collection and is the receiver of various
-// endpoint controllers which will need mongoDB collection access
+// Posts holds references to the user and post repositories and image storage, and is the
+// receiver of various endpoint controllers which will need access to them
 type Posts struct {
-	UserCollection *mongo.Collection
-	PostCollection *mongo.Collection
-	StorageClient  *storage.Client
-	StorageBucket  string
+	UserRepo repository.UserRepository
+	PostRepo repository.PostRepository
+	Storage  blobstore.Store
+	Timeouts Timeouts
+	// MaxImageSize is the largest image accepted, in bytes. Defaults to DefaultMaxImageSize
+	MaxImageSize int64
+	// PageSize is the number of posts in a page of a list when the request has no limit, and
+	// MaxPageSize the largest limit allowed. They default to DefaultPageSize and DefaultMaxPageSize
+	PageSize    int64
+	MaxPageSize int64
+	// Logger receives errors, tagged with the request. Defaults to slog.Default
+	Logger *slog.Logger
+}
+
+// DefaultMaxImageSize is used when Posts.MaxImageSize isn't set
+const DefaultMaxImageSize = 10 * 1024 * 1024
+
+// checkImageSize rejects images larger than the configured limit
+func (posts *Posts) checkImageSize(image *multipart.FileHeader) error {
+	limit := posts.MaxImageSize
+	if limit <= 0 {
+		limit = DefaultMaxImageSize
+	}
+
+	if image.Size <= limit {
+		return nil
+	}
+
+	size := fmt.Sprintf("%d bytes", limit)
+	if limit%(1024*1024) == 0 {
+		size = fmt.Sprintf("%d Megabytes", limit/(1024*1024))
+	}
+
+	return apierror.ErrImageTooLarge.WithMessage("We currently limit the size of image files to " + size)
+}
+
+// detectImageType sniffs the type of an uploaded image from its content. The Content-Type header and
+// file name come from the client, so an html or svg file could claim to be a png, and would then be
+// served as active content from our origin
+func detectImageType(image *multipart.FileHeader) (string, error) {
+	f, err := image.Open()
+	if err != nil {
+		return "", apierror.ErrBadRequest.WithMessage("Could not read the provided image file").WithInternal(err)
+	}
+
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", apierror.ErrBadRequest.WithMessage("Could not read the provided image file").WithInternal(err)
+	}
+
+	contentType := http.DetectContentType(head[:n])
+	if _, ok := model.ImageExtensions[contentType]; !ok {
+		return "", apierror.ErrImageType
+	}
+
+	return contentType, nil
+}
+
+// storeImage uploads the provided image to the storage backend under a newly created unique id,
+// and returns that id. The id ends in the extension of contentType, never one chosen by the client
+func (posts *Posts) storeImage(ctx context.Context, image *multipart.FileHeader, contentType string) (string, error) {
+	f, err := image.Open()
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	// create unique id for file
+	storageID := model.NewImageKey(contentType)
+
+	if err := posts.Storage.Put(ctx, storageID, f, contentType); err != nil {
+		return "", err
+	}
+
+	return storageID, nil
+}
+
+// discardImage removes an uploaded image that could not be saved to the post of request c. It uses
+// its own context, since it usually runs after the request context has failed
+func (posts *Posts) discardImage(c echo.Context, storageID string) {
+	ctx, cancel := posts.Timeouts.cleanup()
+	defer cancel()
+
+	if err := posts.Storage.Delete(ctx, storageID); err != nil {
+		logging.ForRequest(posts.Logger, c).Error("could not discard image", "storage_id", storageID, "error", err)
+	}
+}
+
+// writeAborted reports whether a post write which failed with err is known not to have been saved, so
+// the image uploaded for it can be discarded. A write which timed out, was cancelled, or whose commit
+// got lost may still have been saved, so its image is kept, and left to the reconcile command
+func writeAborted(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, repository.ErrCommitUnknown)
 }
 
 // CreatePost creates (duh) a post for the current user (set in context from jwt middleware)
 func (posts *Posts) CreatePost(c echo.Context) error {
-	// Key receives an interface, make sure to use type assertion to jwt.Token
-	// like wise, Claims is of type (jwt.MapClaims)... Oh delightful type assertion!
-	// uid := getUID(c)
+	// the jwt middleware has already verified the token's claims and stored the current user
+	principal, err := util.GetPrincipal(c)
+
+	if err != nil {
+		return apierror.ErrLoginRequired.WithMessage("Could not get user credential")
+	}
 
 	// before doing transferring files and such, make sure the user is in the database
 	// cancel context after time out of if erros
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // use this context for all operations
+	ctx, cancel := posts.Timeouts.upload(c) // use this context for all operations
 	defer cancel()
 
 	// get active userID as Object ID
-	currentUserID, convErr := primitive.ObjectIDFromHex(util.GetUID(c))
-
-	if convErr != nil {
-		cancel()
-		return echo.NewHTTPError(http.StatusInternalServerError, "Problem storing data")
-	}
-
-	count, err := posts.UserCollection.CountDocuments(ctx, bson.M{"_id": currentUserID})
+	currentUserID := principal.UserID
 
-	if count < 1 || err != nil {
+	if _, err := posts.UserRepo.FindByID(ctx, currentUserID); err != nil {
 		// need to think about this status code
 		cancel()
-		return echo.NewHTTPError(http.StatusBadRequest, "User doesn't exist")
+		return apierror.ErrUserNotFound
 	}
 
-	// get request values
+	// get request values, and check them before uploading anything
 	title := c.FormValue("title")
 	description := c.FormValue("description")
-	image, err := c.FormFile("image")
+	visibility := model.Visibility(c.FormValue("visibility"))
 
-	if err != nil {
+	if err := c.Validate(&model.Post{Title: title, Description: description, Visibility: visibility}); err != nil {
 		cancel()
 		return err
 	}
 
-	// Check to make sure we have an image an limit the file sizee
-	mimeTypes := image.Header["Content-Type"]
-	if !util.ContainsImage(mimeTypes) {
-		cancel()
-		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Image must be of the following file type: jpeg, gif, png, svg, or webp")
+	if visibility == "" {
+		visibility = model.VisibilityPublic
 	}
 
-	// set a limit on the file size of 10 MB... maybe should be less
-	if image.Size > (1024 * 1024 * 10) {
-		cancel()
-		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "We currently limit the size of image files to 10 Megabytes")
-	}
+	image, err := c.FormFile("image")
 
-	// open file and send to GC storage
-	f, err := image.Open()
 	if err != nil {
 		cancel()
-		return echo.NewHTTPError(http.StatusInternalServerError, "Problem uploading the provided image file")
+		return apierror.ErrImageRequired
 	}
 
-	defer f.Close()
-
-	// create unique id for file
-	storageID := uuid.New().String() + "-" + image.Filename
-
-	o := posts.StorageClient.Bucket(posts.StorageBucket).Object(storageID)
+	// limit the file size, 10 MB unless configured otherwise
+	if err := posts.checkImageSize(image); err != nil {
+		cancel()
+		return err
+	}
 
-	wc := o.NewWriter(ctx)
-	if _, err = io.Copy(wc, f); err != nil {
+	// Check to make sure we have an image, going by its content
+	contentType, err := detectImageType(image)
+	if err != nil {
 		cancel()
-		return echo.NewHTTPError(http.StatusInternalServerError, "Problem uploading the provided image file")
+		return err
 	}
-	if err := wc.Close(); err != nil {
+
+	// send file to the storage backend
+	storageID, err := posts.storeImage(ctx, image, contentType)
+	if err != nil {
 		cancel()
-		return echo.NewHTTPError(http.StatusInternalServerError, "Problem uploading the provided image file")
+		return apierror.Internal("Problem uploading the provided image file", err)
 	}
 
 	// create url
-	baseURL := "https://storage.googleapis.com/" + posts.StorageBucket + "/"
-	url := baseURL + storageID
+	url := posts.Storage.PublicURL(storageID)
 
-	// store Post in posts collection, and then add post's storageID to users Posts List
-	d := bson.M{"title": title, "description": description, "publicUrl": url, "storageId": storageID, "user": util.GetUserName(c)}
-	result, insErr := posts.PostCollection.InsertOne(ctx, d)
+	// store Post in posts collection, and then add post's ID to users Posts List
+	// the repository does both at once, so a post is never saved without being in its user's list
+	d := &model.Post{Title: title, Description: description, PublicURL: url, StorageID: storageID, User: principal.UserName, Visibility: visibility, CreatedAt: time.Now().UTC().Truncate(time.Millisecond)}
+	oid, err := posts.PostRepo.Create(ctx, currentUserID, d)
 
-	if insErr != nil {
+	if err != nil {
+		aborted := writeAborted(ctx, err)
 		cancel()
-		return echo.NewHTTPError(http.StatusInternalServerError, "Problem storing data")
-	}
-
-	// store result id in user's posts array
-	oid := result.InsertedID.(primitive.ObjectID)
 
-	// update record of currently authenticated user... add to this user's posts array
-	updateErr := posts.UserCollection.FindOneAndUpdate(ctx, bson.M{"_id": currentUserID}, bson.M{"$addToSet": bson.M{"posts": oid}}).Err()
+		// nothing was saved, so the uploaded image isn't needed anymore
+		if aborted {
+			posts.discardImage(c, storageID)
+		}
 
-	if updateErr != nil {
-		cancel()
-		return echo.NewHTTPError(http.StatusInternalServerError, "Problem storing data")
+		return apierror.Internal("Problem storing data", err)
 	}
 
 	response := &model.Post{
-		ID: oid,
+		ID:         oid,
+		Visibility: d.Visibility,
+		CreatedAt:  d.CreatedAt,
 	}
 
 	return c.JSON(http.StatusOK, response)
 }
 
-// GetUserPosts extracts the user ID from a json web-token, and returns a list of that user's posts
+// GetUserPosts extracts the user ID from a json web-token, and returns a list of all that user's
+// posts, whatever their visibility
 func (posts *Posts) GetUserPosts(c echo.Context) error {
 	// first get the current user from jwt middleware
-	uid, err := primitive.ObjectIDFromHex(util.GetUID(c)) // as ObjectID
+	principal, err := util.GetPrincipal(c)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Could not get user credential")
+		return apierror.ErrLoginRequired.WithMessage("Could not get user credential")
 	}
 
-	dbCtx, dbCancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer dbCancel()
+	uid := principal.UserID
 
-	// retrieve limit and skip
-	params := new(model.PostList)
+	dbCtx, dbCancel := posts.Timeouts.db(c)
+	defer dbCancel()
 
-	if err := c.Bind(params); err != nil {
+	// retrieve limit and skip, or the cursor
+	params, page, err := posts.listParams(c)
+	if err != nil {
 		return err
 	}
 
-	// retrieve user's list of post ObjectID's from UserCollection - need to return total count, too
-	userResp := &model.User{}
-	err = posts.UserCollection.FindOne(dbCtx, bson.M{"_id": uid}).Decode(userResp)
+	// retrieve user's posts from the repository - in order of creation
+	// need to return total count, too
+	respPosts, total, err := posts.PostRepo.ListByUser(dbCtx, uid, page)
 
-	if err != nil {
+	if err == repository.ErrNotFound {
 		dbCancel()
-		return echo.NewHTTPError(http.StatusBadRequest, "No user found. Please login")
+		return apierror.ErrUserNotFound.WithMessage("No user found. Please login")
 	}
 
-	// get actual post data from PostCollection - default sort, use limit and skip
-	findOptions := options.Find()
-	findOptions.SetLimit(params.Limit)
-	findOptions.SetSkip(params.Skip)
-
-	cursor, err := posts.PostCollection.Find(dbCtx, bson.M{"_id": bson.M{"$in": userResp.Posts}}, findOptions)
-
 	if err != nil {
 		dbCancel()
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return apierror.Internal("Could not load posts", err)
 	}
 
-	// decode response into a slice of posts
-	respPosts := []*model.Post{}
+	// The final response
+	params.Total = total
+	setPage(params, page, respPosts)
 
-	for cursor.Next(dbCtx) {
-		elem := &model.Post{} // type to decode into... dangling preposition! O shame!
-		if err := cursor.Decode(elem); err != nil {
-			dbCancel()
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-		}
+	return c.JSON(http.StatusOK, params)
+}
 
-		respPosts = append(respPosts, elem)
+// GetPost returns the post with the id in the path, along with its author's public profile. Ids
+// which can't name a post are treated like unknown ones, since share links may be mangled. So are
+// posts the visitor may not see, which shouldn't give away that they exist
+func (posts *Posts) GetPost(c echo.Context) error {
+	postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return apierror.ErrPostNotFound
 	}
 
-	if err := cursor.Err(); err != nil {
-		dbCancel()
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-	}
+	ctx, cancel := posts.Timeouts.db(c)
+	defer cancel()
 
-	// The final response
-	resp := &model.PostList{
-		Posts: respPosts,
-		Total: int64(len(userResp.Posts)),
-		Limit: params.Limit,
-		Skip:  params.Skip,
+	post, err := posts.PostRepo.FindByID(ctx, postID)
+	if err == repository.ErrNotFound {
+		return apierror.ErrPostNotFound
 	}
 
-	return c.JSON(http.StatusOK, resp)
-}
-
-// GetPosts gets all posts that are public
-// Note, currently users don't have public or private post settings, but can in the future
-func (posts *Posts) GetPosts(c echo.Context) error {
-	// retrieve limit and skip
-	params := new(model.PostList)
-	if err := c.Bind(params); err != nil {
-		return err
+	if err != nil {
+		return apierror.Internal("Could not load post", err)
 	}
 
-	// get actual post data from PostCollection - use limit and skip
-	findOptions := options.Find()
-	findOptions.SetLimit(params.Limit)
-	findOptions.SetSkip(params.Skip)
+	// the optional jwt middleware sets the user of logged in visitors
+	if !post.VisibleTo(util.GetUserName(c)) {
+		return apierror.ErrPostNotFound
+	}
 
-	dbCtx, dbCancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer dbCancel()
+	resp := &model.PostDetail{Post: post}
 
-	// get totall count on collection using metadata since we're not filtering
-	postCount, err := posts.PostCollection.EstimatedDocumentCount(dbCtx)
+	// posts only keep their author's user name
+	author, err := posts.UserRepo.FindByUserName(ctx, post.User)
+	if err == repository.ErrNotFound {
+		return c.JSON(http.StatusOK, resp)
+	}
 
-	// use a find without filters and above FindOptions
-	cursor, err := posts.PostCollection.Find(dbCtx, bson.M{}, findOptions)
 	if err != nil {
-		dbCancel()
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return apierror.Internal("Could not load post", err)
 	}
 
+	// the profile is public, so it only counts the posts anyone can see
+	postCount, err := posts.PostRepo.CountPublicByUser(ctx, post.User)
 	if err != nil {
-		dbCancel()
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return apierror.Internal("Could not load post", err)
 	}
 
-	// decode response into a slice of posts
-	respPosts := []*model.Post{}
+	resp.Author = author.Profile(postCount)
 
-	for cursor.Next(dbCtx) {
-		elem := &model.Post{} // type to decode into... dangling preposition! O shame!
-		if err := cursor.Decode(elem); err != nil {
-			dbCancel()
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-		}
+	return c.JSON(http.StatusOK, resp)
+}
 
-		respPosts = append(respPosts, elem)
+// GetPosts gets all posts that are public. Unlisted, followers-only, and private posts are left out
+func (posts *Posts) GetPosts(c echo.Context) error {
+	// retrieve limit and skip, or the cursor
+	params, page, err := posts.listParams(c)
+	if err != nil {
+		return err
 	}
 
-	if err := cursor.Err(); err != nil {
+	dbCtx, dbCancel := posts.Timeouts.db(c)
+	defer dbCancel()
+
+	// get actual post data along with the total count
+	respPosts, postCount, err := posts.PostRepo.List(dbCtx, page)
+
+	if err != nil {
 		dbCancel()
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return apierror.Internal("Could not load posts", err)
 	}
 
 	// The final response
-	resp := &model.PostList{
-		Posts: respPosts,
-		Total: postCount,
-		Limit: params.Limit,
-		Skip:  params.Skip,
-	}
+	params.Total = postCount
+	setPage(params, page, respPosts)
 
-	return c.JSON(http.StatusOK, resp)
+	return c.JSON(http.StatusOK, params)
 }
 
 // DeletePost retrieves the ID of a post from url and deletes it given that the psot belongs
@@ -270,62 +345,59 @@ func (posts *Posts) DeletePost(c echo.Context) error {
 	postID, err := primitive.ObjectIDFromHex(c.Param("id"))
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Could not parse provided id. Please provide a valid post id")
+		return apierror.ErrInvalidID
 	}
 
 	// check is zero objectID (ie, no id provided by query body or params)
 	if postID.IsZero() {
-		return echo.NewHTTPError(http.StatusBadRequest, "Please provide the document ID as a query parameter, or in the body as 'id'")
+		return apierror.ErrInvalidID.WithMessage("Please provide the document ID as a query parameter, or in the body as 'id'")
 	}
 
 	// get current userID
-	uid, err := primitive.ObjectIDFromHex(util.GetUID(c)) // as ObjectID
+	principal, err := util.GetPrincipal(c)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Could not get user credential")
+		return apierror.ErrLoginRequired.WithMessage("Could not get user credential")
 	}
 
-	dbCtx, dbCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	uid := principal.UserID
+
+	dbCtx, dbCancel := posts.Timeouts.db(c)
 	defer dbCancel()
 
 	// try to update document for this user by deleting it from their posts list
 	// if there's an error, or ObjectID doesn't exist in user's posts list, we won't delete
-	// any items from the Posts collection
-	updateResult, err := posts.UserCollection.UpdateOne(
-		dbCtx,
-		bson.M{
-			"_id": uid,
-		},
-		bson.M{
-			"$pull": bson.M{
-				"posts": postID,
-			},
-		},
-	)
+	// any items from the Posts collection. The repository does both at once
+	// the deleted document is returned so we know which image to remove from storage
+	deletedPost, err := posts.PostRepo.Delete(dbCtx, uid, postID)
 
-	if err != nil {
+	if err == repository.ErrNotOwned {
 		dbCancel()
-		return echo.NewHTTPError(http.StatusBadRequest, "Could not remove post for current user.")
+		return apierror.ErrPostNotOwned.WithMessage("Could not remove post for current user.")
 	}
 
-	// if the post list was not modified
-	if updateResult.ModifiedCount == 0 {
+	// the post was deleted after it was added to the user's list, ie by a concurrent request
+	if err == repository.ErrNotFound {
 		dbCancel()
-		return echo.NewHTTPError(http.StatusBadRequest, "Could not remove post for current user.")
+		return apierror.ErrPostNotFound
 	}
 
-	// if we did modify users list, we can delete post from Posts Collection
-	deleteResult, err := posts.PostCollection.DeleteOne(dbCtx, bson.M{
-		"_id": postID,
-	})
+	if err != nil {
+		dbCancel()
+		return apierror.Internal("Failed to delete document", err)
+	}
 
-	if err != nil || deleteResult.DeletedCount < 1 {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete document")
+	// the image is only deleted once the post is gone for good. A failure here only leaves an orphaned image, which the
+	// reconcile command can clean up later
+	if deletedPost.StorageID != "" {
+		if err := posts.Storage.Delete(dbCtx, deletedPost.StorageID); err != nil && err != blobstore.ErrNotExist {
+			logging.ForRequest(posts.Logger, c).Error("could not delete image of removed post", "storage_id", deletedPost.StorageID, "error", err)
+		}
 	}
 
 	return c.JSON(http.StatusOK, bson.M{
 		"message":          fmt.Sprintf("Successfully removed post with the following id: %v", postID.Hex()),
-		"deletedPostCount": deleteResult.DeletedCount,
+		"deletedPostCount": 1,
 	})
 }
 
@@ -335,39 +407,38 @@ func (posts *Posts) EditPost(c echo.Context) error {
 	var newImage *multipart.FileHeader
 	var newStorageID string
 
-	// we start with empty map and add properties conditionally if they are requested
-	updatedPost := bson.M{}
+	// we start with an empty update and add properties conditionally if they are requested
+	updatedPost := &repository.PostUpdate{}
 
 	// fetch the PostID and make sure it is in the current user's list
 	postID, err := primitive.ObjectIDFromHex(c.Param("id"))
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Could not parse provided id. Please provide a valid post id")
+		return apierror.ErrInvalidID
 	}
 
 	// check is zero objectID (ie, no id provided by query body or params)
 	if postID.IsZero() {
-		return echo.NewHTTPError(http.StatusBadRequest, "Please provide the document ID as a query parameter, or in the body as 'id'")
+		return apierror.ErrInvalidID.WithMessage("Please provide the document ID as a query parameter, or in the body as 'id'")
 	}
 
 	// get current userID
-	uid, err := primitive.ObjectIDFromHex(util.GetUID(c)) // as ObjectID
+	principal, err := util.GetPrincipal(c)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Could not get user credential")
+		return apierror.ErrLoginRequired.WithMessage("Could not get user credential")
 	}
 
-	dbCtx, dbCancel := context.WithTimeout(context.Background(), 15*time.Second)
+	uid := principal.UserID
+
+	dbCtx, dbCancel := posts.Timeouts.upload(c)
 	defer dbCancel()
-	// make sure the document exists for this user with CountDocument
-	postCount, err := posts.UserCollection.CountDocuments(dbCtx, bson.M{
-		"_id":   uid,
-		"posts": postID,
-	})
+	// make sure the document exists for this user
+	owned, err := posts.UserRepo.OwnsPost(dbCtx, uid, postID)
 
-	if postCount < 1 || err != nil {
+	if !owned || err != nil {
 		dbCancel()
-		return echo.NewHTTPError(http.StatusBadRequest, "Could not modify post for current user.")
+		return apierror.ErrPostNotOwned
 	}
 
 	// Determine which fields exist in multi-part form data. Only store these values if they're available
@@ -375,100 +446,109 @@ func (posts *Posts) EditPost(c echo.Context) error {
 	form, err := c.MultipartForm()
 	if err != nil {
 		dbCancel()
-		return err
+		return apierror.ErrBadRequest.WithMessage("Please send the changes as multipart form data").WithInternal(err)
 	}
 
-	// see if values exist on form map - assign to updated post map if this is the case
+	// see if values exist on form map - assign to updated post if this is the case
 	if val, ok := form.Value["title"]; ok {
-		updatedPost["title"] = val[0]
+		updatedPost.Title = &val[0]
 	}
 
 	if val, ok := form.Value["description"]; ok {
-		updatedPost["description"] = val[0]
+		updatedPost.Description = &val[0]
+	}
+
+	if val, ok := form.Value["visibility"]; ok {
+		visibility := model.Visibility(val[0])
+		updatedPost.Visibility = &visibility
 	}
 
 	if val, ok := form.File["image"]; ok {
 		newImage = val[0]
 	}
 
-	// If an image is available, we need to delete the former image, and upload a new image
-	if newImage != nil {
-		// first verify image is valid type and size
-		mimeTypes := newImage.Header["Content-Type"]
-		if !util.ContainsImage(mimeTypes) {
-			dbCancel()
-			return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Image must be of the following file type: jpeg, gif, png, svg, or webp")
-		}
+	// check the sent fields against the rules on model.Post
+	edit := &model.Post{}
+	fields := []string{}
 
-		// set a limit on the file size of 10 MB... maybe should be less
-		if newImage.Size > (1024 * 1024 * 10) {
-			dbCancel()
-			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "We currently limit the size of image files to 10 Megabytes")
-		}
+	if updatedPost.Title != nil {
+		edit.Title = *updatedPost.Title
+		fields = append(fields, "Title")
+	}
 
-		postToUpdate := &model.Post{}
+	if updatedPost.Description != nil {
+		edit.Description = *updatedPost.Description
+		fields = append(fields, "Description")
+	}
 
-		err := posts.PostCollection.FindOne(dbCtx, bson.M{"_id": postID}).Decode(postToUpdate)
+	if updatedPost.Visibility != nil {
+		edit.Visibility = *updatedPost.Visibility
+		fields = append(fields, "Visibility")
+	}
 
-		if err != nil {
+	if len(fields) > 0 {
+		if err := c.Validate(validation.Fields(edit, fields...)); err != nil {
 			dbCancel()
-			return echo.NewHTTPError(http.StatusInternalServerError, "Could not update post for current user")
+			return err
 		}
+	}
 
-		// get storageID of old image and delete
-		oldStorageID := postToUpdate.StorageID
-		o := posts.StorageClient.Bucket(posts.StorageBucket).Object(oldStorageID)
-		if err := o.Delete(dbCtx); err != nil {
+	// If an image is available, we need to delete the former image, and upload a new image
+	if newImage != nil {
+		// first verify image is valid size and type
+		// limit the file size, 10 MB unless configured otherwise
+		if err := posts.checkImageSize(newImage); err != nil {
 			dbCancel()
 			return err
 		}
 
-		// create a new storage id, and upload file to server
-		newStorageID = uuid.New().String() + "-" + newImage.Filename
-		oUpdate := posts.StorageClient.Bucket(posts.StorageBucket).Object(newStorageID)
-
-		// open file and send to GC storage
-		f, err := newImage.Open()
+		contentType, err := detectImageType(newImage)
 		if err != nil {
 			dbCancel()
-			return echo.NewHTTPError(http.StatusInternalServerError, "Problem uploading the provided image file")
+			return err
 		}
 
-		defer f.Close()
-
-		wc := oUpdate.NewWriter(dbCtx)
-		if _, err = io.Copy(wc, f); err != nil {
-			dbCancel()
-			return echo.NewHTTPError(http.StatusInternalServerError, "Problem uploading the provided image file")
-		}
-		if err := wc.Close(); err != nil {
+		// upload the new image under a new storage id first. The old image is only deleted once the
+		// post points at the new one, so a failed request never leaves a post without its image
+		newStorageID, err = posts.storeImage(dbCtx, newImage, contentType)
+		if err != nil {
 			dbCancel()
-			return echo.NewHTTPError(http.StatusInternalServerError, "Problem uploading the provided image file")
+			return apierror.Internal("Problem uploading the provided image file", err)
 		}
 
-		// add new storage ID and post ID to updatedPost map
-		baseURL := "https://storage.googleapis.com/" + posts.StorageBucket + "/"
-		updatedPost["storageId"] = newStorageID
-		updatedPost["publicUrl"] = baseURL + newStorageID
+		// add new storage ID and public url to updatedPost
+		publicURL := posts.Storage.PublicURL(newStorageID)
+		updatedPost.StorageID = &newStorageID
+		updatedPost.PublicURL = &publicURL
 	}
 
 	// Having successfully uploaded new file, we can update Post with new fields
-	// Use set operator to updated fields added in updatePost map above
-	updatedPostBSON := bson.M{
-		"$set": updatedPost,
-	}
+	// the post before the update tells us which image was replaced
+	postToUpdate, respPost, err := posts.PostRepo.Update(dbCtx, postID, updatedPost)
 
-	respPost := &model.Post{}
+	if err != nil {
+		aborted := writeAborted(dbCtx, err)
+		dbCancel()
 
-	// return newly updated docuemnt instead of old one (the default return value)
-	updateOptions := options.FindOneAndUpdate()
-	updateOptions.SetReturnDocument(options.After)
+		// the post still refers to its old image, so drop the new one
+		if newStorageID != "" && aborted {
+			posts.discardImage(c, newStorageID)
+		}
 
-	err = posts.PostCollection.FindOneAndUpdate(dbCtx, bson.M{"_id": postID}, updatedPostBSON, updateOptions).Decode(respPost)
+		// the post was deleted after we checked it was the user's
+		if err == repository.ErrNotFound {
+			return apierror.ErrPostNotFound
+		}
 
-	if err != nil {
-		dbCancel()
-		return err
+		return apierror.Internal("Could not update post for current user", err)
+	}
+
+	// the post now refers to the new image, so the old one can go. A failure here only leaves an
+	// orphaned image, which the reconcile command can clean up later
+	if newStorageID != "" && postToUpdate.StorageID != "" {
+		if err := posts.Storage.Delete(dbCtx, postToUpdate.StorageID); err != nil && err != blobstore.ErrNotExist {
+			logging.ForRequest(posts.Logger, c).Error("could not delete replaced image", "storage_id", postToUpdate.StorageID, "error", err)
+		}
 	}
 
 	return c.JSON(http.StatusOK, respPost)
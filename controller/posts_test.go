@@ -0,0 +1,633 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Maxbrain0/echo_mongo/apierror"
+	"github.com/Maxbrain0/echo_mongo/auth"
+	"github.com/Maxbrain0/echo_mongo/blobstore"
+	"github.com/Maxbrain0/echo_mongo/model"
+	"github.com/Maxbrain0/echo_mongo/repository"
+	"github.com/Maxbrain0/echo_mongo/validation"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// createPost uploads a post with a png image and returns its id
+func (s *testServer) createPost(t *testing.T, token string, title string) primitive.ObjectID {
+	t.Helper()
+
+	contentType, body := multipartForm(t, map[string]string{"title": title, "description": "about " + title}, pngFile(title+".png"))
+
+	rec := s.do(http.MethodPost, "/admin/post", contentType, body, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	created := &model.Post{}
+	decode(t, rec, created)
+
+	return created.ID
+}
+
+// listPosts fetches path and decodes the post list
+func (s *testServer) listPosts(t *testing.T, path string, token string) *model.PostList {
+	t.Helper()
+
+	rec := s.do(http.MethodGet, path, "", nil, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	list := &model.PostList{}
+	decode(t, rec, list)
+
+	return list
+}
+
+func TestCreatePost(t *testing.T) {
+	s := newTestServer(t)
+	token := s.signup(t, "ann")
+
+	id := s.createPost(t, token, "soup")
+
+	list := s.listPosts(t, "/admin/posts", token)
+	if list.Total != 1 || len(list.Posts) != 1 {
+		t.Fatalf("expected one post, got %+v", list)
+	}
+
+	post := list.Posts[0]
+	if post.ID != id || post.Title != "soup" || post.Description != "about soup" || post.User != "ann" {
+		t.Fatalf("unexpected post %+v", post)
+	}
+
+	if post.PublicURL != "/uploads/"+post.StorageID || !strings.HasSuffix(post.StorageID, ".png") || strings.Contains(post.StorageID, "soup") {
+		t.Fatalf("unexpected image location %q %q", post.PublicURL, post.StorageID)
+	}
+
+	r, err := s.store.Open(context.Background(), post.StorageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	data, _ := ioutil.ReadAll(r)
+	if string(data) != string(pngFile("soup.png").data) {
+		t.Fatalf("stored image differs from upload: %q", data)
+	}
+
+	// the public url of a memory image is served too
+	rec := s.do(http.MethodGet, post.PublicURL, "", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	if rec.Body.String() != string(data) || rec.Header().Get(echo.HeaderContentType) != "image/png" {
+		t.Fatalf("unexpected image at the public url: %q %v", rec.Body.String(), rec.Header())
+	}
+}
+
+func TestCreatePostRejectsBadUploads(t *testing.T) {
+	s := newTestServer(t)
+	token := s.signup(t, "ann")
+	fields := map[string]string{"title": "soup"}
+
+	t.Run("invalid fields", func(t *testing.T) {
+		invalid := map[string]string{"title": strings.Repeat("soup", 26), "description": "bad\x00byte"}
+		contentType, body := multipartForm(t, invalid, pngFile("soup.png"))
+		resp := expectError(t, s.do(http.MethodPost, "/admin/post", contentType, body, token), http.StatusBadRequest, apierror.ErrValidation.Code)
+
+		if len(resp.Details) != 2 || resp.Details[0].Field != "title" || resp.Details[1].Field != "description" {
+			t.Fatalf("expected title and description to be invalid, got %+v", resp.Details)
+		}
+	})
+
+	t.Run("no image", func(t *testing.T) {
+		contentType, body := multipartForm(t, fields, nil)
+		expectStatus(t, s.do(http.MethodPost, "/admin/post", contentType, body, token), http.StatusBadRequest)
+	})
+
+	t.Run("not an image", func(t *testing.T) {
+		file := &testFile{name: "soup.txt", contentType: "text/plain", data: []byte("soup")}
+		contentType, body := multipartForm(t, fields, file)
+		expectStatus(t, s.do(http.MethodPost, "/admin/post", contentType, body, token), http.StatusUnsupportedMediaType)
+	})
+
+	t.Run("html claiming to be a png", func(t *testing.T) {
+		file := &testFile{name: "soup.html", contentType: "image/png", data: []byte("<html><script>alert(1)</script></html>")}
+		contentType, body := multipartForm(t, fields, file)
+		expectError(t, s.do(http.MethodPost, "/admin/post", contentType, body, token), http.StatusUnsupportedMediaType, apierror.ErrImageType.Code)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		file := pngFile("huge.png")
+		file.data = make([]byte, 10*1024*1024+1)
+		contentType, body := multipartForm(t, fields, file)
+		expectStatus(t, s.do(http.MethodPost, "/admin/post", contentType, body, token), http.StatusRequestEntityTooLarge)
+	})
+
+	if n := s.objectCount(t); n != 0 {
+		t.Fatalf("rejected uploads must not be stored, found %d images", n)
+	}
+}
+
+func TestPostsRequireAuth(t *testing.T) {
+	s := newTestServer(t)
+	token := s.signup(t, "ann")
+	id := s.createPost(t, token, "soup")
+	path := "/admin/post/" + id.Hex()
+
+	// without a token the request is malformed, with a bad one it is unauthorized
+	tests := []struct {
+		token string
+		code  int
+	}{
+		{"", http.StatusBadRequest},
+		{"not-a-jwt", http.StatusUnauthorized},
+		{token + "x", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		contentType, body := multipartForm(t, map[string]string{"title": "soup"}, pngFile("soup.png"))
+		expectStatus(t, s.do(http.MethodPost, "/admin/post", contentType, body, tt.token), tt.code)
+		expectStatus(t, s.do(http.MethodGet, "/admin/posts", "", nil, tt.token), tt.code)
+		expectStatus(t, s.do(http.MethodDelete, path, "", nil, tt.token), tt.code)
+
+		contentType, body = multipartForm(t, map[string]string{"title": "stew"}, nil)
+		expectStatus(t, s.do(http.MethodPut, path, contentType, body, tt.token), tt.code)
+	}
+
+	if n := s.objectCount(t); n != 1 {
+		t.Fatalf("unauthorized requests must not store images, found %d images", n)
+	}
+
+	// the public list doesn't need a token
+	if list := s.listPosts(t, "/posts", ""); list.Total != 1 {
+		t.Fatalf("expected one public post, got %+v", list)
+	}
+}
+
+func TestGetPostsPagination(t *testing.T) {
+	s := newTestServer(t)
+	ann := s.signup(t, "ann")
+	bob := s.signup(t, "bob")
+
+	for i := 0; i < 5; i++ {
+		s.createPost(t, ann, fmt.Sprintf("ann-%d", i))
+	}
+
+	for i := 0; i < 2; i++ {
+		s.createPost(t, bob, fmt.Sprintf("bob-%d", i))
+	}
+
+	tests := []struct {
+		path   string
+		token  string
+		total  int64
+		titles []string
+	}{
+		{"/posts", "", 7, []string{"ann-0", "ann-1", "ann-2", "ann-3", "ann-4", "bob-0", "bob-1"}},
+		{"/posts?limit=2", "", 7, []string{"ann-0", "ann-1"}},
+		{"/posts?limit=2&skip=4", "", 7, []string{"ann-4", "bob-0"}},
+		{"/posts?skip=10", "", 7, []string{}},
+		{"/admin/posts", ann, 5, []string{"ann-0", "ann-1", "ann-2", "ann-3", "ann-4"}},
+		{"/admin/posts?limit=2&skip=2", ann, 5, []string{"ann-2", "ann-3"}},
+		{"/admin/posts?skip=1", bob, 2, []string{"bob-1"}},
+	}
+
+	for _, tt := range tests {
+		list := s.listPosts(t, tt.path, tt.token)
+
+		titles := []string{}
+		for _, post := range list.Posts {
+			titles = append(titles, post.Title)
+		}
+
+		if list.Total != tt.total || strings.Join(titles, ",") != strings.Join(tt.titles, ",") {
+			t.Errorf("%s: expected total %d %v, got total %d %v", tt.path, tt.total, tt.titles, list.Total, titles)
+		}
+	}
+}
+
+func TestGetPost(t *testing.T) {
+	s := newTestServer(t)
+	ann := s.signup(t, "ann")
+	id := s.createPost(t, ann, "soup")
+
+	// no login needed, so share links work
+	rec := s.do(http.MethodGet, "/posts/"+id.Hex(), "", nil, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	post := &model.PostDetail{}
+	decode(t, rec, post)
+
+	if post.ID != id || post.Title != "soup" || post.Author == nil || post.Author.UserName != "ann" || post.Author.PostCount != 1 {
+		t.Fatalf("unexpected post %+v, author %+v", post.Post, post.Author)
+	}
+
+	if strings.Contains(rec.Body.String(), "password") {
+		t.Fatalf("author's password was sent: %s", rec.Body.String())
+	}
+
+	expectError(t, s.do(http.MethodGet, "/posts/"+primitive.NewObjectID().Hex(), "", nil, ""), http.StatusNotFound, "post_not_found")
+	expectError(t, s.do(http.MethodGet, "/posts/nope", "", nil, ""), http.StatusNotFound, "post_not_found")
+}
+
+func TestPostVisibility(t *testing.T) {
+	s := newTestServer(t)
+	ann := s.signup(t, "ann")
+	bob := s.signup(t, "bob")
+
+	ids := map[model.Visibility]primitive.ObjectID{}
+
+	for _, visibility := range []model.Visibility{model.VisibilityPublic, model.VisibilityUnlisted, model.VisibilityFollowers, model.VisibilityPrivate} {
+		contentType, body := multipartForm(t, map[string]string{"title": string(visibility), "visibility": string(visibility)}, pngFile("soup.png"))
+		rec := s.do(http.MethodPost, "/admin/post", contentType, body, ann)
+		expectStatus(t, rec, http.StatusOK)
+
+		created := &model.Post{}
+		decode(t, rec, created)
+		ids[visibility] = created.ID
+	}
+
+	// posts are public unless told otherwise
+	defaulted := s.createPost(t, ann, "soup")
+
+	if list := s.listPosts(t, "/posts", ""); list.Total != 2 || len(list.Posts) != 2 {
+		t.Fatalf("expected only the public posts to be listed, got %+v", list)
+	}
+
+	if list := s.listPosts(t, "/admin/posts", ann); list.Total != 5 {
+		t.Fatalf("expected the author to see all their posts, got %+v", list)
+	}
+
+	visible := func(id primitive.ObjectID, token string) bool {
+		rec := s.do(http.MethodGet, "/posts/"+id.Hex(), "", nil, token)
+		if rec.Code == http.StatusNotFound {
+			return false
+		}
+
+		expectStatus(t, rec, http.StatusOK)
+
+		return true
+	}
+
+	for visibility, id := range ids {
+		shared := visibility == model.VisibilityPublic || visibility == model.VisibilityUnlisted
+
+		if visible(id, "") != shared || visible(id, bob) != shared {
+			t.Errorf("%s post: expected visible to others %v", visibility, shared)
+		}
+
+		if !visible(id, ann) {
+			t.Errorf("%s post: expected the author to see it", visibility)
+		}
+	}
+
+	if !visible(defaulted, "") {
+		t.Error("expected a post without a visibility to be public")
+	}
+
+	// a bad token is ignored rather than rejected, so it doesn't hide public posts
+	if !visible(defaulted, "nope") || visible(ids[model.VisibilityPrivate], "nope") {
+		t.Error("expected a bad token to be treated as not logged in")
+	}
+
+	// the author's profile only counts the posts anyone can see, whoever asks
+	for _, token := range []string{"", ann} {
+		rec := s.do(http.MethodGet, "/posts/"+ids[model.VisibilityUnlisted].Hex(), "", nil, token)
+		expectStatus(t, rec, http.StatusOK)
+
+		post := &model.PostDetail{}
+		decode(t, rec, post)
+
+		if post.Author == nil || post.Author.PostCount != 2 {
+			t.Errorf("expected the author to have 2 public posts, got %+v", post.Author)
+		}
+	}
+
+	t.Run("edit", func(t *testing.T) {
+		contentType, body := multipartForm(t, map[string]string{"visibility": "private"}, nil)
+		expectStatus(t, s.do(http.MethodPut, "/admin/post/"+defaulted.Hex(), contentType, body, ann), http.StatusOK)
+
+		if visible(defaulted, "") {
+			t.Fatal("expected the post to be private after the edit")
+		}
+
+		contentType, body = multipartForm(t, map[string]string{"visibility": "friends"}, nil)
+		resp := expectError(t, s.do(http.MethodPut, "/admin/post/"+defaulted.Hex(), contentType, body, ann), http.StatusBadRequest, apierror.ErrValidation.Code)
+
+		if len(resp.Details) != 1 || resp.Details[0].Field != "visibility" || resp.Details[0].Rule != "oneof" {
+			t.Fatalf("expected the visibility to be rejected, got %+v", resp.Details)
+		}
+	})
+}
+
+func TestGetPostsCursors(t *testing.T) {
+	s := newTestServer(t)
+	ann := s.signup(t, "ann")
+
+	for i := 0; i < 5; i++ {
+		s.createPost(t, ann, fmt.Sprintf("ann-%d", i))
+	}
+
+	titles := func(list *model.PostList) string {
+		names := []string{}
+		for _, post := range list.Posts {
+			names = append(names, post.Title)
+		}
+
+		return strings.Join(names, ",")
+	}
+
+	first := s.listPosts(t, "/posts?limit=2", "")
+	if titles(first) != "ann-0,ann-1" || first.NextCursor == "" || first.PrevCursor != "" {
+		t.Fatalf("unexpected first page %+v", first)
+	}
+
+	// a post added while paging shows up at the end, without repeating any posts
+	s.createPost(t, ann, "ann-5")
+
+	second := s.listPosts(t, "/posts?limit=2&cursor="+first.NextCursor, "")
+	if titles(second) != "ann-2,ann-3" || second.Total != 6 || second.PrevCursor == "" {
+		t.Fatalf("unexpected second page %+v", second)
+	}
+
+	last := s.listPosts(t, "/posts?limit=2&cursor="+second.NextCursor, "")
+	if titles(last) != "ann-4,ann-5" || last.NextCursor != "" {
+		t.Fatalf("unexpected last page %+v", last)
+	}
+
+	back := s.listPosts(t, "/posts?limit=2&cursor="+last.PrevCursor, "")
+	if titles(back) != titles(second) || back.NextCursor != second.NextCursor || back.PrevCursor != second.PrevCursor {
+		t.Fatalf("expected the previous page to be the second page, got %+v", back)
+	}
+
+	if start := s.listPosts(t, "/posts?limit=2&cursor="+back.PrevCursor, ""); titles(start) != titles(first) || start.PrevCursor != "" {
+		t.Fatalf("expected to be back at the first page, got %+v", start)
+	}
+
+	// skip pages get cursors too, and the user's own list pages the same way
+	if skipped := s.listPosts(t, "/admin/posts?limit=2&skip=2", ann); titles(skipped) != "ann-2,ann-3" || skipped.NextCursor != second.NextCursor || skipped.PrevCursor != second.PrevCursor {
+		t.Fatalf("unexpected skip page %+v", skipped)
+	}
+
+	if list := s.listPosts(t, "/posts?limit=1000", ""); list.Limit != DefaultMaxPageSize || len(list.Posts) != 6 {
+		t.Fatalf("expected the limit to be capped, got %+v", list)
+	}
+
+	if list := s.listPosts(t, "/posts", ""); list.Limit != DefaultPageSize {
+		t.Fatalf("expected the default page size, got %+v", list)
+	}
+
+	expectError(t, s.do(http.MethodGet, "/posts?cursor=nope", "", nil, ""), http.StatusBadRequest, apierror.ErrInvalidCursor.Code)
+	expectError(t, s.do(http.MethodGet, "/posts?skip=2&cursor="+first.NextCursor, "", nil, ""), http.StatusBadRequest, apierror.ErrBadRequest.Code)
+	expectError(t, s.do(http.MethodGet, "/posts?limit=-1", "", nil, ""), http.StatusBadRequest, apierror.ErrBadRequest.Code)
+}
+
+func TestDeletePost(t *testing.T) {
+	s := newTestServer(t)
+	ann := s.signup(t, "ann")
+	bob := s.signup(t, "bob")
+	id := s.createPost(t, ann, "soup")
+	path := "/admin/post/" + id.Hex()
+
+	// someone else's post, and ids which aren't posts
+	expectStatus(t, s.do(http.MethodDelete, path, "", nil, bob), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodDelete, "/admin/post/nope", "", nil, ann), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodDelete, "/admin/post/"+primitive.NewObjectID().Hex(), "", nil, ann), http.StatusBadRequest)
+
+	if n := s.objectCount(t); n != 1 {
+		t.Fatalf("expected the image to be kept, found %d images", n)
+	}
+
+	expectStatus(t, s.do(http.MethodDelete, path, "", nil, ann), http.StatusOK)
+
+	if list := s.listPosts(t, "/admin/posts", ann); list.Total != 0 {
+		t.Fatalf("expected no posts after delete, got %+v", list)
+	}
+
+	if n := s.objectCount(t); n != 0 {
+		t.Fatalf("expected the image to be deleted, found %d images", n)
+	}
+
+	expectStatus(t, s.do(http.MethodDelete, path, "", nil, ann), http.StatusBadRequest)
+}
+
+func TestEditPost(t *testing.T) {
+	s := newTestServer(t)
+	ann := s.signup(t, "ann")
+	bob := s.signup(t, "bob")
+	id := s.createPost(t, ann, "soup")
+	path := "/admin/post/" + id.Hex()
+	original := s.listPosts(t, "/admin/posts", ann).Posts[0]
+
+	t.Run("fields", func(t *testing.T) {
+		contentType, body := multipartForm(t, map[string]string{"title": "stew"}, nil)
+		rec := s.do(http.MethodPut, path, contentType, body, ann)
+		expectStatus(t, rec, http.StatusOK)
+
+		post := &model.Post{}
+		decode(t, rec, post)
+
+		if post.Title != "stew" || post.Description != original.Description || post.StorageID != original.StorageID {
+			t.Fatalf("expected only the title to change, got %+v", post)
+		}
+	})
+
+	t.Run("image", func(t *testing.T) {
+		contentType, body := multipartForm(t, nil, pngFile("stew.png"))
+		rec := s.do(http.MethodPut, path, contentType, body, ann)
+		expectStatus(t, rec, http.StatusOK)
+
+		post := &model.Post{}
+		decode(t, rec, post)
+
+		if post.StorageID == original.StorageID || post.PublicURL != "/uploads/"+post.StorageID {
+			t.Fatalf("expected a new image, got %+v", post)
+		}
+
+		if _, err := s.store.Open(context.Background(), original.StorageID); err == nil {
+			t.Fatal("the replaced image should be deleted")
+		}
+
+		if n := s.objectCount(t); n != 1 {
+			t.Fatalf("expected only the new image to be stored, found %d images", n)
+		}
+	})
+
+	t.Run("invalid fields", func(t *testing.T) {
+		// only the fields sent are checked, so the missing description is fine but an empty title isn't
+		contentType, body := multipartForm(t, map[string]string{"title": ""}, nil)
+		resp := expectError(t, s.do(http.MethodPut, path, contentType, body, ann), http.StatusBadRequest, apierror.ErrValidation.Code)
+
+		if len(resp.Details) != 1 || resp.Details[0].Field != "title" || resp.Details[0].Rule != "required" {
+			t.Fatalf("expected the title to be required, got %+v", resp.Details)
+		}
+	})
+
+	t.Run("not an image", func(t *testing.T) {
+		file := &testFile{name: "stew.txt", contentType: "text/plain", data: []byte("stew")}
+		contentType, body := multipartForm(t, nil, file)
+		expectStatus(t, s.do(http.MethodPut, path, contentType, body, ann), http.StatusUnsupportedMediaType)
+	})
+
+	t.Run("not owned", func(t *testing.T) {
+		contentType, body := multipartForm(t, map[string]string{"title": "mine now"}, nil)
+		expectStatus(t, s.do(http.MethodPut, path, contentType, body, bob), http.StatusBadRequest)
+
+		if post := s.listPosts(t, "/admin/posts", ann).Posts[0]; post.Title != "stew" {
+			t.Fatalf("post was changed by another user: %+v", post)
+		}
+	})
+}
+
+// deletingPosts deletes a post right before updating it, like a concurrent DeletePost would
+type deletingPosts struct {
+	repository.PostRepository
+	userID primitive.ObjectID
+}
+
+func (r *deletingPosts) Update(ctx context.Context, postID primitive.ObjectID, update *repository.PostUpdate) (*model.Post, *model.Post, error) {
+	if _, err := r.PostRepository.Delete(ctx, r.userID, postID); err != nil {
+		return nil, nil, err
+	}
+
+	return r.PostRepository.Update(ctx, postID, update)
+}
+
+func TestEditDeletedPost(t *testing.T) {
+	db := repository.NewMemoryDB()
+	store := blobstore.NewMemory("/uploads")
+
+	userID, err := db.Users().Create(context.Background(), &model.User{UserName: "ann", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postID, err := db.Posts().Create(context.Background(), userID, &model.Post{Title: "soup", User: "ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts := &Posts{UserRepo: db.Users(), PostRepo: &deletingPosts{PostRepository: db.Posts(), userID: userID}, Storage: store}
+
+	e := echo.New()
+	e.Validator = validation.New()
+	e.HTTPErrorHandler = apierror.Handler
+	e.PUT("/admin/post/:id", posts.EditPost, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(auth.ContextKey, &auth.Principal{UserID: userID, UserName: "ann"})
+			return next(c)
+		}
+	})
+
+	contentType, body := multipartForm(t, map[string]string{"title": "stew"}, pngFile("stew.png"))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/admin/post/"+postID.Hex(), body)
+	req.Header.Set(echo.HeaderContentType, contentType)
+	e.ServeHTTP(rec, req)
+
+	expectError(t, rec, http.StatusNotFound, apierror.ErrPostNotFound.Code)
+
+	if objects, _ := store.List(context.Background()); len(objects) != 0 {
+		t.Fatalf("expected the new image to be discarded, found %d images", len(objects))
+	}
+}
+
+// uncommittedPosts fails every write as if the connection dropped while committing it, so nobody
+// knows whether the write was saved
+type uncommittedPosts struct {
+	repository.PostRepository
+}
+
+func (r *uncommittedPosts) Create(ctx context.Context, userID primitive.ObjectID, post *model.Post) (primitive.ObjectID, error) {
+	return primitive.NilObjectID, fmt.Errorf("%w: connection reset", repository.ErrCommitUnknown)
+}
+
+func (r *uncommittedPosts) Update(ctx context.Context, postID primitive.ObjectID, update *repository.PostUpdate) (*model.Post, *model.Post, error) {
+	return nil, nil, fmt.Errorf("%w: connection reset", repository.ErrCommitUnknown)
+}
+
+func TestUnknownCommitKeepsImage(t *testing.T) {
+	db := repository.NewMemoryDB()
+	store := blobstore.NewMemory("/uploads")
+
+	userID, err := db.Users().Create(context.Background(), &model.User{UserName: "ann", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postID, err := db.Posts().Create(context.Background(), userID, &model.Post{Title: "soup", User: "ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts := &Posts{UserRepo: db.Users(), PostRepo: &uncommittedPosts{PostRepository: db.Posts()}, Storage: store}
+
+	e := echo.New()
+	e.Validator = validation.New()
+	e.HTTPErrorHandler = apierror.Handler
+	setPrincipal := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(auth.ContextKey, &auth.Principal{UserID: userID, UserName: "ann"})
+			return next(c)
+		}
+	}
+	e.POST("/admin/post", posts.CreatePost, setPrincipal)
+	e.PUT("/admin/post/:id", posts.EditPost, setPrincipal)
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/admin/post"},
+		{http.MethodPut, "/admin/post/" + postID.Hex()},
+	}
+
+	for i, r := range requests {
+		contentType, body := multipartForm(t, map[string]string{"title": "stew"}, pngFile("stew.png"))
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(r.method, r.path, body)
+		req.Header.Set(echo.HeaderContentType, contentType)
+		e.ServeHTTP(rec, req)
+
+		expectStatus(t, rec, http.StatusInternalServerError)
+
+		// the post may refer to the image after all, so only reconcile may remove it
+		if objects, _ := store.List(context.Background()); len(objects) != i+1 {
+			t.Fatalf("%s %s: expected %d kept images, found %d", r.method, r.path, i+1, len(objects))
+		}
+	}
+}
+
+// vanishedPosts finds the post in the user's list, but the post itself is gone, like after a
+// concurrent DeletePost
+type vanishedPosts struct {
+	repository.PostRepository
+}
+
+func (r *vanishedPosts) Delete(ctx context.Context, userID primitive.ObjectID, postID primitive.ObjectID) (*model.Post, error) {
+	return nil, repository.ErrNotFound
+}
+
+func TestDeleteVanishedPost(t *testing.T) {
+	db := repository.NewMemoryDB()
+	userID := primitive.NewObjectID()
+	posts := &Posts{UserRepo: db.Users(), PostRepo: &vanishedPosts{PostRepository: db.Posts()}, Storage: blobstore.NewMemory("/uploads")}
+
+	e := echo.New()
+	e.HTTPErrorHandler = apierror.Handler
+	e.DELETE("/admin/post/:id", posts.DeletePost, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(auth.ContextKey, &auth.Principal{UserID: userID, UserName: "ann"})
+			return next(c)
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/post/"+primitive.NewObjectID().Hex(), nil))
+
+	expectError(t, rec, http.StatusNotFound, apierror.ErrPostNotFound.Code)
+}
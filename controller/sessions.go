@@ -0,0 +1,282 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/apierror"
+	"github.com/Maxbrain0/echo_mongo/auth"
+	"github.com/Maxbrain0/echo_mongo/logging"
+	"github.com/Maxbrain0/echo_mongo/model"
+	"github.com/Maxbrain0/echo_mongo/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// accessTokenTTL is how long a jwt is valid. Access tokens are short lived, since they cannot be
+// revoked until the session check runs, and clients get a new one from /refresh
+const accessTokenTTL = 15 * time.Minute
+
+// refreshTokenTTL is how long a session lasts without logging in again
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+// tokenResponse is sent to clients which asked for their tokens in the response body, ie mobile
+// apps and scripts, which then send the access token in an Authorization: Bearer header
+type tokenResponse struct {
+	Message      string `json:"message"`
+	AccessToken  string `json:"accessToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int64  `json:"expiresIn"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// refreshRequest is the body of /refresh and /logout for clients which don't use cookies
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken" form:"refreshToken"`
+}
+
+// newRefreshToken creates a random refresh token and the hash we store for it
+func newRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	return token, hashRefreshToken(token), nil
+}
+
+// hashRefreshToken returns the hex encoded sha256 of a refresh token
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// startSession stores a new session for the user, and sends the access and refresh tokens
+func (users *Users) startSession(ctx context.Context, c echo.Context, user *model.User, inBody bool) error {
+	refreshToken, tokenHash, err := newRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	session := &model.Session{
+		UserID:    user.ID,
+		UserName:  user.UserName,
+		TokenHash: tokenHash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(refreshTokenTTL),
+	}
+
+	session.ID, err = users.SessionRepo.Create(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	return users.sendTokens(c, session, refreshToken, inBody, "Login successful")
+}
+
+// sendTokens signs an access token for the session, and sends it along with the refresh token,
+// either in cookies or, if inBody is set, in the JSON response
+func (users *Users) sendTokens(c echo.Context, session *model.Session, refreshToken string, inBody bool, message string) error {
+	expires := time.Now().Add(accessTokenTTL)
+
+	// Set claims
+	claims := auth.NewClaims(&auth.Principal{
+		UserID:    session.UserID,
+		UserName:  session.UserName,
+		SessionID: session.ID,
+	}, expires.Unix())
+
+	// Generate encoded token with the current signing key
+	t, err := users.Keys.Sign(claims)
+	if err != nil {
+		return err
+	}
+
+	if inBody {
+		return c.JSON(http.StatusOK, &tokenResponse{
+			Message:      message,
+			AccessToken:  t,
+			TokenType:    "Bearer",
+			ExpiresIn:    int64(accessTokenTTL / time.Second),
+			RefreshToken: refreshToken,
+		})
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     auth.CookieName,
+		Value:    t,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+	})
+
+	c.SetCookie(&http.Cookie{
+		Name:     auth.RefreshCookieName,
+		Value:    refreshToken,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+	})
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": message,
+	})
+}
+
+// refreshTokenFromRequest reads the refresh token from the JSON body, or else from its cookie.
+// inBody reports whether it came from the body, in which case responses should use the body, too
+func refreshTokenFromRequest(c echo.Context) (token string, inBody bool) {
+	req := new(refreshRequest)
+	if err := c.Bind(req); err == nil && req.RefreshToken != "" {
+		return req.RefreshToken, true
+	}
+
+	if cookie, err := c.Cookie(auth.RefreshCookieName); err == nil {
+		return cookie.Value, false
+	}
+
+	return "", false
+}
+
+// clearTokenCookies tells the client to drop both token cookies
+func clearTokenCookies(c echo.Context) {
+	for _, name := range []string{auth.CookieName, auth.RefreshCookieName} {
+		c.SetCookie(&http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			Expires:  time.Unix(0, 0),
+			MaxAge:   -1,
+			HttpOnly: true,
+		})
+	}
+}
+
+// Refresh exchanges the refresh token for a new access token and a new refresh token. The refresh
+// token is read from the refreshToken field of the body, or else from its cookie, and the new tokens
+// are sent back the same way. Each refresh token works once. Presenting one which was already used
+// means it was copied, so the whole session is revoked
+func (users *Users) Refresh(c echo.Context) error {
+	oldToken, inBody := refreshTokenFromRequest(c)
+	if oldToken == "" {
+		return apierror.ErrLoginRequired
+	}
+
+	ctx, cancel := users.Timeouts.db(c)
+	defer cancel()
+
+	tokenHash := hashRefreshToken(oldToken)
+
+	refreshToken, newHash, err := newRefreshToken()
+	if err != nil {
+		return apierror.Internal("Could not refresh login", err)
+	}
+
+	// swap in the new token hash, as long as the session is still active
+	session, err := users.SessionRepo.Rotate(ctx, tokenHash, newHash, time.Now())
+
+	if err == repository.ErrNotFound {
+		// revoke the session if this token was already used. If that fails, the copied token's
+		// session stays usable, so the client has to know it wasn't revoked
+		if err := users.SessionRepo.RevokeByUsedHash(ctx, tokenHash); err != nil {
+			logging.ForRequest(users.Logger, c).Error("could not revoke session of reused refresh token", "error", err)
+			return apierror.Internal("Could not refresh login", err)
+		}
+
+		clearTokenCookies(c)
+		return apierror.ErrSessionExpired
+	}
+
+	if err != nil {
+		logging.ForRequest(users.Logger, c).Error("could not rotate session", "error", err)
+		return apierror.Internal("Could not refresh login", err)
+	}
+
+	if err := users.sendTokens(c, session, refreshToken, inBody, "Refresh successful"); err != nil {
+		logging.ForRequest(users.Logger, c).Error("could not send tokens", "user_id", session.UserID.Hex(), "error", err)
+		return apierror.Internal("Could not refresh login", err)
+	}
+
+	return nil
+}
+
+// Logout revokes the session of the refresh token (from the body or cookie, as in Refresh) and clears
+// the token cookies. It works without a valid access token, since that may already have expired
+func (users *Users) Logout(c echo.Context) error {
+	clearTokenCookies(c)
+
+	refreshToken, _ := refreshTokenFromRequest(c)
+	if refreshToken != "" {
+		ctx, cancel := users.Timeouts.db(c)
+		defer cancel()
+
+		if err := users.SessionRepo.RevokeByTokenHash(ctx, hashRefreshToken(refreshToken)); err != nil {
+			logging.ForRequest(users.Logger, c).Error("could not revoke session", "error", err)
+			return apierror.Internal("Could not logout", err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Logout successful",
+	})
+}
+
+// CheckSession is middleware for routes behind the jwt middleware. It rejects access tokens whose
+// session has been revoked by a logout, or by reuse of a refresh token
+func (users *Users) CheckSession(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		principal, ok := auth.PrincipalFrom(c)
+		if !ok {
+			return apierror.ErrLoginRequired
+		}
+
+		ctx, cancel := users.Timeouts.db(c)
+		defer cancel()
+
+		active, err := users.SessionRepo.IsActive(ctx, principal.SessionID)
+		if err != nil {
+			logging.ForRequest(users.Logger, c).Error("could not check session", "session_id", principal.SessionID.Hex(), "error", err)
+			return apierror.Internal("Could not verify login", err)
+		}
+
+		if !active {
+			return apierror.ErrSessionExpired
+		}
+
+		return next(c)
+	}
+}
+
+// CheckOptionalSession is CheckSession for routes behind the optional jwt middleware. Tokens of
+// revoked sessions are dropped, so the request carries on as if it wasn't logged in
+func (users *Users) CheckOptionalSession(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		principal, ok := auth.PrincipalFrom(c)
+		if !ok {
+			return next(c)
+		}
+
+		ctx, cancel := users.Timeouts.db(c)
+		active, err := users.SessionRepo.IsActive(ctx, principal.SessionID)
+		cancel()
+
+		if err != nil {
+			logging.ForRequest(users.Logger, c).Error("could not check session", "session_id", principal.SessionID.Hex(), "error", err)
+			return apierror.Internal("Could not verify login", err)
+		}
+
+		if !active {
+			c.Set(auth.ContextKey, nil)
+		}
+
+		return next(c)
+	}
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Timeouts limits how long the operations of a request may take. Operations get a context derived
+// from the request's context, so they are also cancelled when the client goes away or the server
+// stops waiting for requests on shutdown. Zero values use DefaultTimeouts
+type Timeouts struct {
+	// DB limits database reads and writes
+	DB time.Duration
+	// Upload limits requests which store an image, including saving their post
+	Upload time.Duration
+	// Cleanup limits deleting the image of a failed request. It is not tied to the request, which
+	// has usually been cancelled or timed out by then
+	Cleanup time.Duration
+}
+
+// DefaultTimeouts are used for timeouts which are not set
+var DefaultTimeouts = Timeouts{
+	DB:      10 * time.Second,
+	Upload:  30 * time.Second,
+	Cleanup: 10 * time.Second,
+}
+
+// orDefault returns d, or fallback if d isn't set
+func orDefault(d time.Duration, fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+
+	return d
+}
+
+// db returns a context for database operations of the request
+func (t Timeouts) db(c echo.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.Request().Context(), orDefault(t.DB, DefaultTimeouts.DB))
+}
+
+// upload returns a context for requests which store an image
+func (t Timeouts) upload(c echo.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.Request().Context(), orDefault(t.Upload, DefaultTimeouts.Upload))
+}
+
+// cleanup returns a context for removing leftovers of a failed request
+func (t Timeouts) cleanup() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), orDefault(t.Cleanup, DefaultTimeouts.Cleanup))
+}
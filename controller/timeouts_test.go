@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestTimeoutsFollowRequest(t *testing.T) {
+	reqCtx, cancelRequest := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(reqCtx)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	timeouts := Timeouts{DB: time.Minute}
+
+	ctx, cancel := timeouts.db(c)
+	defer cancel()
+
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Fatalf("expected a deadline within a minute, got %v", deadline)
+	}
+
+	// upload isn't set, so it uses the default
+	uploadCtx, cancelUpload := timeouts.upload(c)
+	defer cancelUpload()
+
+	if deadline, _ := uploadCtx.Deadline(); time.Until(deadline) < DefaultTimeouts.Upload-time.Second {
+		t.Fatalf("expected the default upload timeout, got a deadline in %v", time.Until(deadline))
+	}
+
+	cleanupCtx, cancelCleanup := timeouts.cleanup()
+	defer cancelCleanup()
+
+	cancelRequest()
+
+	for _, ctx := range []context.Context{ctx, uploadCtx} {
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("cancelling the request should cancel its operations")
+		}
+	}
+
+	if cleanupCtx.Err() != nil {
+		t.Fatal("cleanup must outlive the request")
+	}
+}
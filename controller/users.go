@@ -1,25 +1,29 @@
 package controller
 
 import (
-	"context"
-	"fmt"
+	"log/slog"
 	"net/http"
-	"time"
 
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/Maxbrain0/echo_mongo/apierror"
+	"github.com/Maxbrain0/echo_mongo/auth"
+	"github.com/Maxbrain0/echo_mongo/logging"
 	"github.com/Maxbrain0/echo_mongo/model"
-	"github.com/dgrijalva/jwt-go"
+	"github.com/Maxbrain0/echo_mongo/repository"
+	"github.com/Maxbrain0/echo_mongo/validation"
 	"github.com/labstack/echo/v4"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// Users holds reference to a database collection and is the receiver of various
-// endpoint controllers which will need mongoDB collection access
+// Users holds references to the user and session repositories and is the receiver of various
+// endpoint controllers which will need access to them
 type Users struct {
-	Collection *mongo.Collection
+	UserRepo    repository.UserRepository
+	SessionRepo repository.SessionRepository
+	Keys        *auth.KeySet
+	Timeouts    Timeouts
+	// Logger receives errors, tagged with the request. Defaults to slog.Default
+	Logger *slog.Logger
 }
 
 // CreateUser creates a user in mongo dB and returns a response on success
@@ -30,43 +34,38 @@ func (users *Users) CreateUser(c echo.Context) error {
 		return err
 	}
 
-	// make sure username and password are in request
-	if len(u.UserName) < 1 || len(u.Password) < 1 {
-		return echo.NewHTTPError(http.StatusBadRequest, "Please provide a user name and password")
+	// check the user name, password, and email against the rules on model.User
+	if err := c.Validate(u); err != nil {
+		return err
 	}
 
-	// determine if userName already exists from find count
-	filter := bson.M{"userName": u.UserName}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := users.Timeouts.db(c)
 	defer cancel()
 
-	count, cErr := users.Collection.CountDocuments(ctx, filter)
+	// Create a hashed password
+	hashedPW, err := bcrypt.GenerateFromPassword([]byte(u.Password), 10)
 
-	if cErr != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Could not add user")
+	// validation limits passwords to what bcrypt accepts, so this is only a safety net
+	if err == bcrypt.ErrPasswordTooLong {
+		return apierror.ErrValidation.WithDetails([]*validation.FieldError{{Field: "password", Rule: "maxbytes", Message: "must be at most 72 bytes long"}})
 	}
 
-	if count != 0 {
-		return echo.NewHTTPError(http.StatusConflict, "User already exists")
+	if err != nil {
+		return apierror.Internal("Could not add user", err)
 	}
 
-	// Create a hashed password
-	hashedPW, err := bcrypt.GenerateFromPassword([]byte(u.Password), 10)
+	// attempt to insert into the database - fails if userName already exists
+	oid, err := users.UserRepo.Create(ctx, &model.User{UserName: u.UserName, Password: string(hashedPW), Email: u.Email})
 
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Could not add user")
+	if err == repository.ErrDuplicate {
+		return apierror.ErrUserExists
 	}
 
-	// attempt to insert into the database
-	res, err := users.Collection.InsertOne(ctx, bson.M{"userName": u.UserName, "password": string(hashedPW), "email": u.Email})
-
 	if err != nil {
-		fmt.Println(err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "Could not add user")
+		logging.ForRequest(users.Logger, c).Error("could not add user", "user_name", u.UserName, "error", err)
+		return apierror.Internal("Could not add user", err)
 	}
 
-	oid := res.InsertedID.(primitive.ObjectID)
-
 	response := &model.User{
 		ID:       oid,
 		UserName: u.UserName,
@@ -77,6 +76,7 @@ func (users *Users) CreateUser(c echo.Context) error {
 
 // Login receives the username and password from from the json request body and determines if the user exist
 // It then compares hashed password, and if successful, returns userName and jwt
+// The tokens are set as cookies, or returned in the body with the query parameter returnTokens=true
 func (users *Users) Login(c echo.Context) error {
 	u := new(model.User)
 
@@ -86,51 +86,34 @@ func (users *Users) Login(c echo.Context) error {
 
 	// make sure username and password are in request
 	if len(u.UserName) < 1 || len(u.Password) < 1 {
-		return echo.NewHTTPError(http.StatusBadRequest, "Please provide a user name and password")
+		return apierror.ErrMissingCredentials
 	}
 
 	// find user in db collection
-	respData := &model.User{} // for now bring in all user data... in future might create simpler struct to return less
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// for now bring in all user data... in future might create simpler struct to return less
+	ctx, cancel := users.Timeouts.db(c)
 	defer cancel()
-	err := users.Collection.FindOne(ctx, bson.M{"userName": u.UserName}).Decode(respData)
+	respData, err := users.UserRepo.FindByUserName(ctx, u.UserName)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusUnauthorized, "Not a valid user or password")
+		return apierror.ErrInvalidCredentials
 	}
 
 	// check password - first arg is hash in db, second is entered from json req
 	err = bcrypt.CompareHashAndPassword([]byte(respData.Password), []byte(u.Password))
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusUnauthorized, "Not a valid user or password")
+		return apierror.ErrInvalidCredentials
 	}
 
-	// Create token
-	token := jwt.New(jwt.SigningMethodHS256)
-	// Set claims
-	claims := token.Claims.(jwt.MapClaims)
-	claims["userName"] = respData.UserName
-	claims["userId"] = respData.ID
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
+	// start a session, which sends a short lived access token and a refresh token
+	inBody := c.QueryParam("returnTokens") == "true"
 
-	// Generate encoded token - make sure to store a better secret as env variable
-	t, err := token.SignedString([]byte("secret"))
-	if err != nil {
+	if err := users.startSession(ctx, c, respData, inBody); err != nil {
 		// consider sending a specific message
-		fmt.Println(err)
-		return err
+		logging.ForRequest(users.Logger, c).Error("could not start session", "user_id", respData.ID.Hex(), "error", err)
+		return apierror.Internal("Could not login", err)
 	}
 
-	cookie := new(http.Cookie)
-	cookie.Name = "token"
-	cookie.Value = t
-	cookie.Expires = time.Now().Add(24 * time.Hour)
-	cookie.HttpOnly = true
-
-	// send token in cookie with success message in JSON
-	c.SetCookie(cookie)
-	return c.JSON(http.StatusOK, map[string]string{
-		"message": "Login successful",
-	})
+	return nil
 }
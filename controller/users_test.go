@@ -0,0 +1,323 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Maxbrain0/echo_mongo/apierror"
+	"github.com/Maxbrain0/echo_mongo/auth"
+	"github.com/Maxbrain0/echo_mongo/model"
+	"github.com/Maxbrain0/echo_mongo/repository"
+	"github.com/labstack/echo/v4"
+)
+
+func TestCreateUser(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.doJSON(t, http.MethodPost, "/user", map[string]string{"userName": "ann", "password": "password1", "email": "ann@example.com"}, "")
+	expectStatus(t, rec, http.StatusCreated)
+
+	created := &model.User{}
+	decode(t, rec, created)
+
+	if created.ID.IsZero() || created.UserName != "ann" {
+		t.Fatalf("unexpected response %+v", created)
+	}
+
+	if created.Password != "" {
+		t.Fatal("the password hash must not be returned")
+	}
+
+	stored, err := s.db.Users().FindByUserName(context.Background(), "ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Password == "password1" {
+		t.Fatal("the password was stored without hashing")
+	}
+}
+
+func TestCreateUserDuplicate(t *testing.T) {
+	s := newTestServer(t)
+	creds := map[string]string{"userName": "ann", "password": "password1", "email": "ann@example.com"}
+
+	expectStatus(t, s.doJSON(t, http.MethodPost, "/user", creds, ""), http.StatusCreated)
+	expectError(t, s.doJSON(t, http.MethodPost, "/user", creds, ""), http.StatusConflict, apierror.ErrUserExists.Code)
+
+	// emails are unique too, but users without one don't conflict
+	sameEmail := map[string]string{"userName": "bob", "password": "password1", "email": "ann@example.com"}
+	expectStatus(t, s.doJSON(t, http.MethodPost, "/user", sameEmail, ""), http.StatusConflict)
+
+	for _, name := range []string{"cat", "dan"} {
+		expectStatus(t, s.doJSON(t, http.MethodPost, "/user", map[string]string{"userName": name, "password": "password1"}, ""), http.StatusCreated)
+	}
+}
+
+func TestCreateUserMissingFields(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, body := range []map[string]string{
+		{"userName": "ann"},
+		{"password": "password1"},
+		{},
+	} {
+		expectStatus(t, s.doJSON(t, http.MethodPost, "/user", body, ""), http.StatusBadRequest)
+	}
+}
+
+func TestCreateUserInvalid(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.doJSON(t, http.MethodPost, "/user", map[string]string{"userName": "ann smith", "password": "short", "email": "ann"}, "")
+	resp := expectError(t, rec, http.StatusBadRequest, apierror.ErrValidation.Code)
+
+	rules := map[string]string{}
+	for _, d := range resp.Details {
+		rules[d.Field] = d.Rule
+	}
+
+	if rules["userName"] != "username" || rules["password"] != "min" || rules["email"] != "email" {
+		t.Fatalf("expected every invalid field to be reported, got %+v", resp.Details)
+	}
+}
+
+func TestCreateUserLongPassword(t *testing.T) {
+	s := newTestServer(t)
+
+	// 40 characters, but 80 bytes, which bcrypt can't hash
+	rec := s.doJSON(t, http.MethodPost, "/user", map[string]string{"userName": "ann", "password": strings.Repeat("é", 40)}, "")
+	resp := expectError(t, rec, http.StatusBadRequest, apierror.ErrValidation.Code)
+
+	if len(resp.Details) != 1 || resp.Details[0].Field != "password" || resp.Details[0].Rule != "maxbytes" {
+		t.Fatalf("expected the password to be too long, got %+v", resp.Details)
+	}
+
+	expectStatus(t, s.doJSON(t, http.MethodPost, "/user", map[string]string{"userName": "ann", "password": strings.Repeat("é", 36)}, ""), http.StatusCreated)
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestServer(t)
+	creds := map[string]string{"userName": "ann", "password": "password1"}
+	expectStatus(t, s.doJSON(t, http.MethodPost, "/user", creds, ""), http.StatusCreated)
+
+	t.Run("cookies", func(t *testing.T) {
+		rec := s.doJSON(t, http.MethodPost, "/login", creds, "")
+		expectStatus(t, rec, http.StatusOK)
+
+		cookies := map[string]bool{}
+		for _, cookie := range rec.Result().Cookies() {
+			cookies[cookie.Name] = cookie.HttpOnly && cookie.Value != ""
+		}
+
+		if !cookies[auth.CookieName] || !cookies[auth.RefreshCookieName] {
+			t.Fatalf("expected http only token cookies, got %v", rec.Result().Cookies())
+		}
+	})
+
+	t.Run("bearer", func(t *testing.T) {
+		rec := s.doJSON(t, http.MethodPost, "/login?returnTokens=true", creds, "")
+		expectStatus(t, rec, http.StatusOK)
+
+		tokens := &tokenResponse{}
+		decode(t, rec, tokens)
+
+		if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.TokenType != "Bearer" {
+			t.Fatalf("unexpected tokens %+v", tokens)
+		}
+
+		expectStatus(t, s.do(http.MethodGet, "/admin/posts", "", nil, tokens.AccessToken), http.StatusOK)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		rec := s.doJSON(t, http.MethodPost, "/login", map[string]string{"userName": "ann", "password": "nope"}, "")
+		expectStatus(t, rec, http.StatusUnauthorized)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		rec := s.doJSON(t, http.MethodPost, "/login", map[string]string{"userName": "bob", "password": "password1"}, "")
+		expectStatus(t, rec, http.StatusUnauthorized)
+	})
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	s := newTestServer(t)
+	creds := map[string]string{"userName": "ann", "password": "password1"}
+	expectStatus(t, s.doJSON(t, http.MethodPost, "/user", creds, ""), http.StatusCreated)
+
+	rec := s.doJSON(t, http.MethodPost, "/login?returnTokens=true", creds, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	tokens := &tokenResponse{}
+	decode(t, rec, tokens)
+
+	expectStatus(t, s.doJSON(t, http.MethodPost, "/logout", map[string]string{"refreshToken": tokens.RefreshToken}, ""), http.StatusOK)
+	expectStatus(t, s.do(http.MethodGet, "/admin/posts", "", nil, tokens.AccessToken), http.StatusUnauthorized)
+}
+
+// login creates a user and logs in, returning the tokens from the body
+func (s *testServer) login(t *testing.T, userName string) *tokenResponse {
+	t.Helper()
+
+	creds := map[string]string{"userName": userName, "password": "password1"}
+	expectStatus(t, s.doJSON(t, http.MethodPost, "/user", creds, ""), http.StatusCreated)
+
+	rec := s.doJSON(t, http.MethodPost, "/login?returnTokens=true", creds, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	tokens := &tokenResponse{}
+	decode(t, rec, tokens)
+
+	return tokens
+}
+
+func TestRefresh(t *testing.T) {
+	s := newTestServer(t)
+	tokens := s.login(t, "ann")
+
+	rec := s.doJSON(t, http.MethodPost, "/refresh", map[string]string{"refreshToken": tokens.RefreshToken}, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	refreshed := &tokenResponse{}
+	decode(t, rec, refreshed)
+
+	if refreshed.AccessToken == "" || refreshed.RefreshToken == "" || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("expected new tokens, got %+v", refreshed)
+	}
+
+	expectStatus(t, s.do(http.MethodGet, "/admin/posts", "", nil, refreshed.AccessToken), http.StatusOK)
+
+	// the old refresh token was copied, so the session and every token of it are revoked
+	rec = s.doJSON(t, http.MethodPost, "/refresh", map[string]string{"refreshToken": tokens.RefreshToken}, "")
+	expectError(t, rec, http.StatusUnauthorized, apierror.ErrSessionExpired.Code)
+
+	rec = s.doJSON(t, http.MethodPost, "/refresh", map[string]string{"refreshToken": refreshed.RefreshToken}, "")
+	expectError(t, rec, http.StatusUnauthorized, apierror.ErrSessionExpired.Code)
+
+	expectError(t, s.do(http.MethodGet, "/admin/posts", "", nil, refreshed.AccessToken), http.StatusUnauthorized, apierror.ErrSessionExpired.Code)
+}
+
+// failingRevokes can't revoke sessions of reused refresh tokens
+type failingRevokes struct {
+	repository.SessionRepository
+}
+
+func (r *failingRevokes) RevokeByUsedHash(ctx context.Context, tokenHash string) error {
+	return errors.New("connection reset")
+}
+
+func TestRefreshRevokeFails(t *testing.T) {
+	s := newTestServer(t)
+	tokens := s.login(t, "ann")
+
+	expectStatus(t, s.doJSON(t, http.MethodPost, "/refresh", map[string]string{"refreshToken": tokens.RefreshToken}, ""), http.StatusOK)
+
+	users := &Users{UserRepo: s.db.Users(), SessionRepo: &failingRevokes{SessionRepository: s.db.Sessions()}}
+	e := echo.New()
+	e.HTTPErrorHandler = apierror.Handler
+	e.POST("/refresh", users.Refresh)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(`{"refreshToken":"`+tokens.RefreshToken+`"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	e.ServeHTTP(rec, req)
+
+	expectStatus(t, rec, http.StatusInternalServerError)
+}
+
+// doWithCookies sends a request with cookies instead of a bearer token, and csrfToken in the
+// X-CSRF-Token header unless it is empty
+func (s *testServer) doWithCookies(method string, path string, contentType string, body io.Reader, cookies []*http.Cookie, csrfToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, body)
+
+	if contentType != "" {
+		req.Header.Set(echo.HeaderContentType, contentType)
+	}
+
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	if csrfToken != "" {
+		req.Header.Set(echo.HeaderXCSRFToken, csrfToken)
+	}
+
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestCSRF(t *testing.T) {
+	s := newTestServer(t)
+	creds := map[string]string{"userName": "ann", "password": "password1"}
+	expectStatus(t, s.doJSON(t, http.MethodPost, "/user", creds, ""), http.StatusCreated)
+
+	rec := s.doJSON(t, http.MethodPost, "/login", creds, "")
+	expectStatus(t, rec, http.StatusOK)
+	cookies := rec.Result().Cookies()
+
+	// any GET hands out the csrf token
+	rec = s.doWithCookies(http.MethodGet, "/admin/posts", "", nil, cookies, "")
+	expectStatus(t, rec, http.StatusOK)
+
+	csrfToken := ""
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "_csrf" {
+			csrfToken = cookie.Value
+			cookies = append(cookies, cookie)
+		}
+	}
+
+	if csrfToken == "" {
+		t.Fatalf("expected a _csrf cookie, got %v", rec.Result().Cookies())
+	}
+
+	token := s.signup(t, "bob")
+	bobsPost := s.createPost(t, token, "bread")
+
+	// bearer requests are never sent by browsers on their own, so they don't need the csrf token
+	contentType, body := multipartForm(t, map[string]string{"title": "rye"}, nil)
+	expectStatus(t, s.do(http.MethodPut, "/admin/post/"+bobsPost.Hex(), contentType, body, token), http.StatusOK)
+	expectStatus(t, s.do(http.MethodDelete, "/admin/post/"+bobsPost.Hex(), "", nil, token), http.StatusOK)
+
+	// cookie requests need it. The post to edit and delete is created with the access token of the
+	// token cookie, sent as a bearer token
+	tokens := map[string]string{}
+	for _, cookie := range cookies {
+		tokens[cookie.Name] = cookie.Value
+	}
+
+	postID := s.createPost(t, tokens[auth.CookieName], "soup")
+
+	requests := []struct {
+		name   string
+		method string
+		path   string
+		form   map[string]string
+	}{
+		{"edit", http.MethodPut, "/admin/post/" + postID.Hex(), map[string]string{"title": "stew"}},
+		{"delete", http.MethodDelete, "/admin/post/" + postID.Hex(), nil},
+		{"logout", http.MethodPost, "/logout", nil},
+	}
+
+	for _, r := range requests {
+		send := func(csrfToken string) *httptest.ResponseRecorder {
+			contentType, body := "", io.Reader(nil)
+			if r.form != nil {
+				contentType, body = multipartForm(t, r.form, nil)
+			}
+
+			return s.doWithCookies(r.method, r.path, contentType, body, cookies, csrfToken)
+		}
+
+		expectError(t, send(""), http.StatusForbidden, apierror.ErrInvalidCSRFToken.Code)
+		expectError(t, send("wrong"), http.StatusForbidden, apierror.ErrInvalidCSRFToken.Code)
+		expectStatus(t, send(csrfToken), http.StatusOK)
+	}
+}
@@ -0,0 +1,86 @@
+// Package instrument holds the helpers shared by the metrics and tracing packages, which observe the
+// same storage and database calls
+package instrument
+
+import (
+	"io"
+
+	"github.com/Maxbrain0/echo_mongo/apierror"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// Counter holds the number of bytes read through a reader returned by Count
+type Counter struct {
+	n int64
+}
+
+// N returns the number of bytes read, or the position reached for readers which were sought
+func (c *Counter) N() int64 {
+	return c.n
+}
+
+// Count wraps r to count the bytes read through it. When r is an io.Seeker so is the wrapper, since
+// stores like S3 seek to measure an upload before sending it
+func Count(r io.Reader) (io.Reader, *Counter) {
+	counting := &countingReader{Reader: r, counter: &Counter{}}
+
+	if seeker, ok := r.(io.Seeker); ok {
+		return &countingReadSeeker{countingReader: counting, seeker: seeker}, counting.counter
+	}
+
+	return counting, counting.counter
+}
+
+// countingReader adds the bytes read to its counter
+type countingReader struct {
+	io.Reader
+	counter *Counter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.counter.n += int64(n)
+
+	return n, err
+}
+
+// countingReadSeeker forwards Seek, and moves the count to the new position so a reader which is
+// measured and rewound isn't counted twice
+type countingReadSeeker struct {
+	*countingReader
+	seeker io.Seeker
+}
+
+func (r *countingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.seeker.Seek(offset, whence)
+	if err == nil {
+		r.counter.n = pos
+	}
+
+	return pos, err
+}
+
+// CommandCollection returns the collection a command works on. For commands like find and insert
+// it is the value of the first element, ie {find: "posts", ...}. Other commands, ie ping, get ""
+func CommandCollection(e *event.CommandStartedEvent) string {
+	elems, err := e.Command.Elements()
+	if err != nil || len(elems) == 0 || elems[0].Key() != e.CommandName {
+		return ""
+	}
+
+	collection, _ := elems[0].Value().StringValueOK()
+
+	return collection
+}
+
+// Status returns the status of the response to c. Errors returned by the handler are only written
+// by the error handler, which runs after the middleware observing them, so their status is taken
+// from the error instead
+func Status(c echo.Context, err error) int {
+	if err != nil && !c.Response().Committed {
+		return apierror.From(err).Status
+	}
+
+	return c.Response().Status
+}
@@ -0,0 +1,48 @@
+package instrument
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCountKeepsSeeker(t *testing.T) {
+	// metrics and tracing both wrap uploads, and the store must still be able to measure them
+	inner, innerCount := Count(bytes.NewReader([]byte("soup")))
+	outer, outerCount := Count(inner)
+
+	seeker, ok := outer.(io.Seeker)
+	if !ok {
+		t.Fatal("expected the wrapped reader to stay an io.Seeker")
+	}
+
+	if size, err := seeker.Seek(0, io.SeekEnd); err != nil || size != 4 {
+		t.Fatalf("expected to measure 4 bytes, got %d %v", size, err)
+	}
+
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadAll(outer)
+	if string(data) != "soup" || innerCount.N() != 4 || outerCount.N() != 4 {
+		t.Fatalf("expected 4 bytes read and counted, got %q %d %d", data, innerCount.N(), outerCount.N())
+	}
+}
+
+func TestCountPlainReader(t *testing.T) {
+	// NopCloser hides the Seek of strings.Reader
+	r, counter := Count(ioutil.NopCloser(strings.NewReader("soup")))
+
+	if _, ok := r.(io.Seeker); ok {
+		t.Fatal("expected a reader which can't seek to stay that way")
+	}
+
+	ioutil.ReadAll(r)
+
+	if counter.N() != 4 {
+		t.Fatalf("expected 4 bytes counted, got %d", counter.N())
+	}
+}
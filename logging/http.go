@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// maxRequestIDLength limits incoming request ids, which end up in every log line of the request
+const maxRequestIDLength = 128
+
+// validRequestID accepts ids of printable ascii without spaces, so a client can't break log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Middleware gives every request an id and writes an access log line when it is done, at error
+// level for server errors and info level otherwise. Register it first, so the id is set for all
+// other middleware. It is also where errors are handled: it calls the error handler itself, so the
+// line shows the status sent, and returns nil so echo doesn't handle the error again
+func Middleware(logger *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			req := c.Request()
+
+			// keep the id of a proxy or calling service, so their logs can be matched with ours
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(id) {
+				id = uuid.New().String()
+			}
+
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			c.SetRequest(req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id)))
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			res := c.Response()
+			attrs := []interface{}{
+				slog.Int("status", res.Status),
+				slog.String("uri", req.RequestURI),
+				slog.String("remote_ip", c.RealIP()),
+				slog.Duration("latency", time.Since(start)),
+				slog.Int64("bytes_out", res.Size),
+			}
+
+			level := slog.LevelInfo
+			if res.Status >= 500 {
+				level = slog.LevelError
+			}
+
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+
+			ForRequest(logger, c).Log(c.Request().Context(), level, "request", attrs...)
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Package logging creates the structured logger of the server, and tags log lines with the request
+// they belong to. Every request gets an id, taken from its X-Request-ID header or generated, which
+// is sent back in the X-Request-ID response header
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/Maxbrain0/echo_mongo/util"
+	"github.com/labstack/echo/v4"
+)
+
+// New returns a logger writing to w. Format is json or text, and level is one of debug, info, warn,
+// or error
+func New(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("logging: unknown level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("logging: unknown format %q", format)
+	}
+}
+
+// requestIDKey stores the request id in the request context
+type requestIDKey struct{}
+
+// RequestID returns the id of the request ctx belongs to, or "" outside of a request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+
+	return id
+}
+
+// ForRequest returns logger with the request id, route, and user id of the request. The user id is
+// only known in routes behind the jwt middleware. A nil logger uses slog.Default
+func ForRequest(logger *slog.Logger, c echo.Context) *slog.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	attrs := []interface{}{
+		slog.String("request_id", RequestID(c.Request().Context())),
+		slog.String("method", c.Request().Method),
+		slog.String("route", c.Path()),
+	}
+
+	if uid := util.GetUID(c); uid != "" {
+		attrs = append(attrs, slog.String("user_id", uid))
+	}
+
+	return logger.With(attrs...)
+}
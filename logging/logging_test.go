@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// serve runs a request with X-Request-ID set to id through a server logging to buf, and returns
+// the response and the decoded log lines
+func serve(t *testing.T, id string) (*httptest.ResponseRecorder, []map[string]interface{}) {
+	var buf bytes.Buffer
+
+	logger, err := New(&buf, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.Use(Middleware(logger))
+	e.GET("/posts/:id", func(c echo.Context) error {
+		ForRequest(logger, c).Error("could not load post", "error", "boom")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Could not load post")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/posts/1", nil)
+	if id != "" {
+		req.Header.Set(echo.HeaderXRequestID, id)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	lines := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q is not json: %v", line, err)
+		}
+
+		lines = append(lines, entry)
+	}
+
+	return rec, lines
+}
+
+func TestMiddlewareTagsLogLines(t *testing.T) {
+	rec, lines := serve(t, "abc-123")
+
+	if got := rec.Header().Get(echo.HeaderXRequestID); got != "abc-123" {
+		t.Errorf("expected the request id to be echoed, got %q", got)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("expected a handler and an access log line, got %v", lines)
+	}
+
+	for _, line := range lines {
+		if line["request_id"] != "abc-123" || line["route"] != "/posts/:id" || line["level"] != "ERROR" {
+			t.Errorf("expected an error line tagged with the request, got %v", line)
+		}
+	}
+
+	if access := lines[1]; access["status"] != float64(http.StatusInternalServerError) {
+		t.Errorf("expected the access line to have the status sent, got %v", access)
+	}
+}
+
+func TestMiddlewareReplacesInvalidRequestID(t *testing.T) {
+	for _, id := range []string{"", "two words", strings.Repeat("a", maxRequestIDLength+1)} {
+		rec, lines := serve(t, id)
+
+		got := rec.Header().Get(echo.HeaderXRequestID)
+		if got == "" || got == id {
+			t.Errorf("expected a new request id instead of %q, got %q", id, got)
+		}
+
+		if lines[0]["request_id"] != got {
+			t.Errorf("expected log lines to use the new request id %q, got %v", got, lines[0])
+		}
+	}
+}
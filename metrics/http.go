@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/internal/instrument"
+	"github.com/labstack/echo/v4"
+)
+
+// unmatchedRoute labels requests which matched no route, so unknown paths can't create new series
+const unmatchedRoute = "unmatched"
+
+// Middleware counts requests and measures their latency, labelled with the name of the matched route,
+// the same name which is written to routes.json. Register it before the routes' own middleware so
+// requests rejected by them are counted, too
+func Middleware(e *echo.Echo) echo.MiddlewareFunc {
+	var once sync.Once
+	names := map[string]string{}
+
+	// routes are added after the middleware, so look up their names on the first request
+	routeName := func(method string, path string) string {
+		once.Do(func() {
+			for _, r := range e.Routes() {
+				names[r.Method+" "+r.Path] = r.Name
+			}
+		})
+
+		if name, ok := names[method+" "+path]; ok {
+			return name
+		}
+
+		return unmatchedRoute
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+
+			method := c.Request().Method
+			route := routeName(method, c.Path())
+
+			httpRequests.WithLabelValues(route, method, strconv.Itoa(instrument.Status(c, err))).Inc()
+			httpDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
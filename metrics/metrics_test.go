@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/blobstore"
+	"github.com/Maxbrain0/echo_mongo/model"
+	"github.com/Maxbrain0/echo_mongo/repository"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddlewareLabelsRouteName(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware(e))
+
+	e.GET("/posts/:id", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "no such post")
+	}).Name = "getPost"
+
+	for _, path := range []string{"/posts/1", "/posts/2", "/nothing/here"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if n := testutil.ToFloat64(httpRequests.WithLabelValues("getPost", http.MethodGet, "404")); n != 2 {
+		t.Errorf("expected 2 requests for the route, got %v", n)
+	}
+
+	if n := testutil.ToFloat64(httpRequests.WithLabelValues(unmatchedRoute, http.MethodGet, "404")); n != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", n)
+	}
+}
+
+func TestStoreCountsUploads(t *testing.T) {
+	store := InstrumentStore(blobstore.NewMemory("/uploads"), "test")
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "a.png", strings.NewReader("12345"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(ctx, "../a.png", strings.NewReader("123"), "image/png"); err == nil {
+		t.Fatal("expected an invalid key error")
+	}
+
+	// an image which is already gone isn't an error
+	store.Delete(ctx, "missing.png")
+
+	if n := testutil.ToFloat64(uploadBytes.WithLabelValues("test")); n != 5 {
+		t.Errorf("expected 5 uploaded bytes, got %v", n)
+	}
+
+	if n := testutil.ToFloat64(storageErrors.WithLabelValues("test", "put")); n != 1 {
+		t.Errorf("expected 1 failed put, got %v", n)
+	}
+
+	if n := testutil.ToFloat64(storageErrors.WithLabelValues("test", "delete")); n != 0 {
+		t.Errorf("expected no failed deletes, got %v", n)
+	}
+}
+
+func TestSessionCollector(t *testing.T) {
+	db := repository.NewMemoryDB()
+	sessions := db.Sessions()
+	ctx := context.Background()
+
+	future := model.Session{ExpiresAt: time.Now().Add(time.Hour)}
+	sessions.Create(ctx, &future)
+	sessions.Create(ctx, &future)
+	sessions.Create(ctx, &model.Session{ExpiresAt: time.Now().Add(-time.Hour)})
+
+	collector := &sessionCollector{
+		repo:    sessions,
+		timeout: time.Second,
+		desc:    prometheus.NewDesc("test_active_sessions", "test", nil, nil),
+	}
+
+	if n := testutil.ToFloat64(collector); n != 2 {
+		t.Errorf("expected 2 active sessions, got %v", n)
+	}
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/internal/instrument"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// CommandMonitor returns a MongoDB command monitor which measures the latency and counts the errors
+// of every command. Pass it to options.Client().SetMonitor
+func CommandMonitor() *event.CommandMonitor {
+	// finished events don't say which collection a command used, so remember it from the start
+	var collections sync.Map
+
+	key := func(connectionID string, requestID int64) string {
+		return connectionID + "/" + strconv.FormatInt(requestID, 10)
+	}
+
+	finished := func(e *event.CommandFinishedEvent, failed bool) {
+		collection := ""
+		if c, ok := collections.Load(key(e.ConnectionID, e.RequestID)); ok {
+			collection = c.(string)
+			collections.Delete(key(e.ConnectionID, e.RequestID))
+		}
+
+		mongoDuration.WithLabelValues(e.CommandName, collection).Observe(time.Duration(e.DurationNanos).Seconds())
+
+		if failed {
+			mongoErrors.WithLabelValues(e.CommandName, collection).Inc()
+		}
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			collections.Store(key(e.ConnectionID, e.RequestID), instrument.CommandCollection(e))
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finished(&e.CommandFinishedEvent, false)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finished(&e.CommandFinishedEvent, true)
+		},
+	}
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/repository"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sessionCollector reports the number of active login sessions, counted when metrics are scraped
+type sessionCollector struct {
+	repo    repository.SessionRepository
+	timeout time.Duration
+	desc    *prometheus.Desc
+}
+
+// RegisterSessions adds a gauge of the active (unrevoked and unexpired) login sessions in repo. Each
+// scrape counts them, waiting at most timeout
+func RegisterSessions(repo repository.SessionRepository, timeout time.Duration) error {
+	return prometheus.Register(&sessionCollector{
+		repo:    repo,
+		timeout: timeout,
+		desc:    prometheus.NewDesc(namespace+"_active_sessions", "Login sessions which are neither revoked nor expired.", nil, nil),
+	})
+}
+
+func (s *sessionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.desc
+}
+
+func (s *sessionCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	count, err := s.repo.CountActive(ctx, time.Now())
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(s.desc, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(s.desc, prometheus.GaugeValue, float64(count))
+}
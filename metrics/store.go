@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/blobstore"
+	"github.com/Maxbrain0/echo_mongo/internal/instrument"
+)
+
+// Store wraps a blobstore.Store, measuring the latency and counting the errors of each operation,
+// and the bytes uploaded
+type Store struct {
+	blobstore.Store
+	// Backend labels the metrics, ie gcs or s3
+	Backend string
+}
+
+// InstrumentStore returns store with metrics labelled by backend
+func InstrumentStore(store blobstore.Store, backend string) *Store {
+	return &Store{Store: store, Backend: backend}
+}
+
+// observe records an operation which started at start. Missing objects aren't counted as errors,
+// since deleting an image which is already gone is expected
+func (s *Store) observe(operation string, start time.Time, err error) {
+	storageDuration.WithLabelValues(s.Backend, operation).Observe(time.Since(start).Seconds())
+
+	if err != nil && err != blobstore.ErrNotExist {
+		storageErrors.WithLabelValues(s.Backend, operation).Inc()
+	}
+}
+
+// Put uploads r, recording its size once the upload succeeded
+func (s *Store) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	start := time.Now()
+	counted, counter := instrument.Count(r)
+
+	err := s.Store.Put(ctx, key, counted, contentType)
+	s.observe("put", start, err)
+
+	if err == nil {
+		uploadBytes.WithLabelValues(s.Backend).Add(float64(counter.N()))
+		uploadSize.WithLabelValues(s.Backend).Observe(float64(counter.N()))
+	}
+
+	return err
+}
+
+// Delete removes key
+func (s *Store) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := s.Store.Delete(ctx, key)
+	s.observe("delete", start, err)
+
+	return err
+}
+
+// Open returns a reader for key. Only opening is measured, not reading
+func (s *Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	start := time.Now()
+	rc, err := s.Store.Open(ctx, key)
+	s.observe("open", start, err)
+
+	return rc, err
+}
+
+// List returns every object
+func (s *Store) List(ctx context.Context) ([]blobstore.Object, error) {
+	start := time.Now()
+	objects, err := s.Store.List(ctx)
+	s.observe("list", start, err)
+
+	return objects, err
+}
+
+// Check tests whether the store can be reached
+func (s *Store) Check(ctx context.Context) error {
+	start := time.Now()
+	err := s.Store.Check(ctx)
+	s.observe("check", start, err)
+
+	return err
+}
+
+var _ blobstore.Store = (*Store)(nil)
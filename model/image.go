@@ -0,0 +1,52 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ImageExtensions maps the image types posts accept to the extension of their stored files
+var ImageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// NewImageKey returns a new unique storage key for an image of contentType. The key ends in the
+// extension of contentType, never one chosen by the client
+func NewImageKey(contentType string) string {
+	return uuid.New().String() + ImageExtensions[contentType]
+}
+
+// IsImageKey reports whether key names an uploaded image: one from NewImageKey, or one from earlier
+// versions, which named images after the uploaded file, ie "<uuid>-soup.png". Other objects in a
+// bucket, ie ones put there by hand or by another app, are none of our business
+func IsImageKey(key string) bool {
+	// uuid.Parse also takes urn: and braced forms, which we never made
+	if len(key) <= uuidLength {
+		return false
+	}
+
+	if _, err := uuid.Parse(key[:uuidLength]); err != nil {
+		return false
+	}
+
+	rest := key[uuidLength:]
+
+	if strings.HasPrefix(rest, "-") {
+		return len(rest) > 1
+	}
+
+	for _, ext := range ImageExtensions {
+		if rest == ext {
+			return true
+		}
+	}
+
+	return false
+}
+
+// uuidLength is the length of a uuid in its usual form, ie 9b2f1c4e-0c1d-4a7e-9f3b-2d6a8c5e7f10
+const uuidLength = 36
@@ -1,21 +1,69 @@
 package model
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
 
-// Post use for handling requests from and db storage of posts
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Visibility controls who can see a post
+type Visibility string
+
+const (
+	// VisibilityPublic posts are listed by GET /posts, and anyone can view them
+	VisibilityPublic Visibility = "public"
+	// VisibilityUnlisted posts can be viewed by anyone with their link, but aren't listed
+	VisibilityUnlisted Visibility = "unlisted"
+	// VisibilityFollowers posts are for the author's followers. Users can't follow each other yet, so
+	// for now only the author sees them
+	VisibilityFollowers Visibility = "followers"
+	// VisibilityPrivate posts are only seen by their author
+	VisibilityPrivate Visibility = "private"
+)
+
+// Post use for handling requests from and db storage of posts. The validate tags apply to the
+// fields clients send
 type Post struct {
 	ID          primitive.ObjectID `json:"id" form:"id" query:"id" bson:"_id"`
-	Title       string             `json:"title,omitempty" form:"title,omitempty" query:"title,omitempty" bson:"title,omitempty"`
-	Description string             `json:"description,omitempty" form:"description,omitempty" query:"description,omitempty" bson:"description,omitempty"`
+	Title       string             `json:"title,omitempty" form:"title,omitempty" query:"title,omitempty" bson:"title,omitempty" validate:"required,max=100,singleline"`
+	Description string             `json:"description,omitempty" form:"description,omitempty" query:"description,omitempty" bson:"description,omitempty" validate:"max=2000,text"`
 	User        string             `json:"user,omitempty" form:"user,omitempty" query:"user,omitempty" bson:"user,omitempty"`
 	PublicURL   string             `json:"publicUrl,omitempty" form:"publicUrl,omitempty" query:"publicUrl,omitempty" bson:"publicUrl,omitempty"`
 	StorageID   string             `json:"storageId,omitempty" form:"storageId,omitempty" query:"storageId,omitempty" bson:"storageId,omitempty"`
+	// Visibility defaults to public. Posts saved before it existed don't have it, and are public
+	Visibility Visibility `json:"visibility,omitempty" form:"visibility,omitempty" query:"visibility,omitempty" bson:"visibility,omitempty" validate:"omitempty,oneof=public unlisted followers private"`
+	// CreatedAt is set when the post is saved. Posts saved before it existed don't have it
+	CreatedAt time.Time `json:"createdAt" form:"-" query:"-" bson:"createdAt,omitempty"`
+}
+
+// VisibleTo reports whether the user called userName can view the post. userName is "" for
+// visitors who aren't logged in
+func (p *Post) VisibleTo(userName string) bool {
+	switch p.Visibility {
+	case "", VisibilityPublic, VisibilityUnlisted:
+		return true
+	}
+
+	return userName != "" && userName == p.User
+}
+
+// PostDetail is a single post with the profile of its author, which is null if the author's account
+// is gone
+type PostDetail struct {
+	*Post
+	Author *Profile `json:"author"`
 }
 
-// PostList will be used for responses retrieving lists of posts
+// PostList will be used for responses retrieving lists of posts. Requests page through a list
+// either with skip, or with the cursors of the page before
 type PostList struct {
 	Posts []*Post `json:"posts" bson:"posts" query:"posts"`
 	Total int64   `json:"total" bson:"total" query:"total"`
 	Limit int64   `json:"limit" bson:"limit" query:"limit"`
 	Skip  int64   `json:"skip" bson:"skip" query:"skip"`
+	// Cursor continues from the nextCursor or prevCursor of another page
+	Cursor string `json:"cursor,omitempty" bson:"cursor,omitempty" query:"cursor"`
+	// NextCursor and PrevCursor are set when there are posts after or before this page
+	NextCursor string `json:"nextCursor,omitempty" bson:"nextCursor,omitempty" query:"-"`
+	PrevCursor string `json:"prevCursor,omitempty" bson:"prevCursor,omitempty" query:"-"`
 }
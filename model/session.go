@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session tracks a login and the refresh token currently issued for it. Only hashes of refresh
+// tokens are stored. Refreshing replaces TokenHash, and the replaced hash is kept in UsedHashes so
+// a stolen, already used token can be detected. Only the last MaxUsedHashes are kept, so the document
+// stays small however often the session is refreshed
+type Session struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `json:"userId" bson:"userId"`
+	UserName   string             `json:"userName" bson:"userName"`
+	TokenHash  string             `json:"-" bson:"tokenHash"`
+	UsedHashes []string           `json:"-" bson:"usedHashes,omitempty"`
+	Revoked    bool               `json:"revoked" bson:"revoked"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  time.Time          `json:"expiresAt" bson:"expiresAt"`
+}
+
+// MaxUsedHashes is the number of replaced refresh token hashes a session keeps. Older tokens are
+// still rejected, but reusing them no longer revokes the session
+const MaxUsedHashes = 50
@@ -2,11 +2,25 @@ package model
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
-// User contains data for tracking users
+// User contains data for tracking users. The validate tags apply to new users. Passwords are limited
+// in bytes rather than characters, since bcrypt rejects passwords over 72 bytes
 type User struct {
 	ID       primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
-	UserName string               `json:"userName" xml:"userName" form:"userName" bson:"userName"`
-	Email    string               `json:"email,omitempty" xml:"email,omitempty" form:"email,omitempty" bson:"email,omitempty"`
-	Password string               `json:"password,omitempty" xml:"password,omitempty" form:"password,omitempty" bson:"password,omitempty"`
+	UserName string               `json:"userName" xml:"userName" form:"userName" bson:"userName" validate:"required,min=3,max=32,username"`
+	Email    string               `json:"email,omitempty" xml:"email,omitempty" form:"email,omitempty" bson:"email,omitempty" validate:"omitempty,max=254,email"`
+	Password string               `json:"password,omitempty" xml:"password,omitempty" form:"password,omitempty" bson:"password,omitempty" validate:"required,min=8,maxbytes=72"`
 	Posts    []primitive.ObjectID `json:"posts,omitempty" xml:"posts,omitempty" form:"posts,omitempty" bson:"posts,omitempty"`
 }
+
+// Profile is the public part of a user, shown to anyone, ie as the author of a post
+type Profile struct {
+	ID        primitive.ObjectID `json:"id"`
+	UserName  string             `json:"userName"`
+	PostCount int64              `json:"postCount"`
+}
+
+// Profile returns the public profile of u, who has postCount public posts. u.Posts also holds the
+// posts nobody else may see, so their number can't be shown
+func (u *User) Profile(postCount int64) *Profile {
+	return &Profile{ID: u.ID, UserName: u.UserName, PostCount: postCount}
+}
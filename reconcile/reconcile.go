@@ -0,0 +1,71 @@
+// Package reconcile finds stored images which no longer belong to a post
+package reconcile
+
+import (
+	"context"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/blobstore"
+	"github.com/Maxbrain0/echo_mongo/model"
+	"github.com/Maxbrain0/echo_mongo/repository"
+)
+
+// Result lists the orphaned objects found by Run, and which of them were removed
+type Result struct {
+	Checked int
+	Orphans []string
+	Removed []string
+	Failed  map[string]error
+}
+
+// Run compares the objects in store with the storageId of every post in postRepo.
+// Only objects named like uploaded images are checked, since a bucket may be shared with other apps.
+// Objects without a post are orphans. Objects updated within minAge are skipped, since an upload
+// may not have been saved to its post yet. If remove is true, orphans are deleted from the store
+func Run(ctx context.Context, store blobstore.Store, postRepo repository.PostRepository, minAge time.Duration, remove bool) (*Result, error) {
+	// list objects before reading posts, so that a post created in between is never missed
+	objects, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	used, err := postRepo.StorageIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Orphans: []string{},
+		Removed: []string{},
+		Failed:  map[string]error{},
+	}
+
+	cutoff := time.Now().Add(-minAge)
+
+	for _, obj := range objects {
+		if !model.IsImageKey(obj.Key) {
+			continue
+		}
+
+		result.Checked++
+
+		if _, ok := used[obj.Key]; ok || obj.Updated.After(cutoff) {
+			continue
+		}
+
+		result.Orphans = append(result.Orphans, obj.Key)
+
+		if !remove {
+			continue
+		}
+
+		if err := store.Delete(ctx, obj.Key); err != nil && err != blobstore.ErrNotExist {
+			result.Failed[obj.Key] = err
+			continue
+		}
+
+		result.Removed = append(result.Removed, obj.Key)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package reconcile
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/blobstore"
+	"github.com/Maxbrain0/echo_mongo/model"
+	"github.com/Maxbrain0/echo_mongo/repository"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	db := repository.NewMemoryDB()
+	store := blobstore.NewMemory("/uploads")
+
+	userID, err := db.Users().Create(ctx, &model.User{UserName: "ann", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used := model.NewImageKey("image/png")
+	orphan := model.NewImageKey("image/jpeg")
+	// earlier versions named images after the uploaded file
+	oldOrphan := "9b2f1c4e-0c1d-4a7e-9f3b-2d6a8c5e7f10-soup.png"
+	// objects of other apps sharing the bucket
+	foreign := []string{"users-backup.json", "logo.png", "9b2f1c4e-0c1d-4a7e-9f3b-2d6a8c5e7f10.txt"}
+
+	for _, key := range append([]string{used, orphan, oldOrphan}, foreign...) {
+		if err := store.Put(ctx, key, strings.NewReader("data"), "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := db.Posts().Create(ctx, userID, &model.Post{Title: "soup", User: "ann", StorageID: used}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Run(ctx, store, db.Posts(), 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Checked != 3 {
+		t.Errorf("expected 3 checked images, got %d", result.Checked)
+	}
+
+	expected := []string{orphan, oldOrphan}
+	sort.Strings(expected)
+	sort.Strings(result.Removed)
+
+	if strings.Join(result.Removed, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected %v to be removed, got %v", expected, result.Removed)
+	}
+
+	objects, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept := map[string]bool{}
+	for _, obj := range objects {
+		kept[obj.Key] = true
+	}
+
+	for _, key := range append([]string{used}, foreign...) {
+		if !kept[key] {
+			t.Errorf("expected %s to be kept", key)
+		}
+	}
+
+	if len(objects) != 1+len(foreign) {
+		t.Errorf("expected %d objects left, got %d", 1+len(foreign), len(objects))
+	}
+}
+
+func TestRunSkipsNewImages(t *testing.T) {
+	ctx := context.Background()
+	db := repository.NewMemoryDB()
+	store := blobstore.NewMemory("/uploads")
+
+	// an upload whose post isn't saved yet
+	if err := store.Put(ctx, model.NewImageKey("image/png"), strings.NewReader("data"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Run(ctx, store, db.Posts(), time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Orphans) != 0 || len(result.Removed) != 0 {
+		t.Fatalf("expected the new image to be skipped, got orphans %v", result.Orphans)
+	}
+}
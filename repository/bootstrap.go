@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collections names the collections of the foodie database
+type Collections struct {
+	Users    string
+	Posts    string
+	Sessions string
+}
+
+// EnsureIndexes creates the indexes the repositories rely on. Creating an index which already exists
+// does nothing, so this runs on every startup. It fails if existing documents break a unique index,
+// ie two users with the same user name, which have to be fixed by hand first
+func EnsureIndexes(ctx context.Context, db *mongo.Database, names Collections) error {
+	indexes := map[string][]mongo.IndexModel{
+		names.Users: {
+			// user names are unique, which CreateUser relies on instead of checking first
+			{Keys: bson.D{{Key: "userName", Value: 1}}, Options: options.Index().SetName("userName_unique").SetUnique(true)},
+			// email is optional, so only users which have one are indexed
+			{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("email_unique").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"email": bson.M{"$type": "string"}})},
+		},
+		names.Posts: {
+			{Keys: bson.D{{Key: "user", Value: 1}, {Key: "createdAt", Value: -1}}, Options: options.Index().SetName("user_createdAt")},
+			{Keys: bson.D{{Key: "createdAt", Value: -1}}, Options: options.Index().SetName("createdAt")},
+			// GET /posts only lists public posts, and pages through them by _id
+			{Keys: bson.D{{Key: "visibility", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("visibility_id")},
+		},
+		names.Sessions: {
+			{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetName("tokenHash")},
+			// refreshing with an unknown token looks it up here, so it mustn't scan the collection
+			{Keys: bson.D{{Key: "usedHashes", Value: 1}}, Options: options.Index().SetName("usedHashes")},
+			// mongo removes sessions once they expire, revoked or not
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0)},
+		},
+	}
+
+	for _, collection := range []string{names.Users, names.Posts, names.Sessions} {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes[collection]); err != nil {
+			return fmt.Errorf("repository: indexes of %s: %v", collection, err)
+		}
+	}
+
+	return nil
+}
+
+// userSchema describes the documents of the users collection
+var userSchema = bson.M{
+	"bsonType": "object",
+	"required": bson.A{"userName", "password"},
+	"properties": bson.M{
+		"userName": bson.M{"bsonType": "string", "minLength": 1},
+		"password": bson.M{"bsonType": "string", "minLength": 1},
+		"email":    bson.M{"bsonType": "string"},
+		"posts":    bson.M{"bsonType": "array", "items": bson.M{"bsonType": "objectId"}},
+	},
+}
+
+// postSchema describes the documents of the posts collection
+var postSchema = bson.M{
+	"bsonType": "object",
+	"required": bson.A{"user", "storageId", "publicUrl", "createdAt"},
+	"properties": bson.M{
+		"title":       bson.M{"bsonType": "string"},
+		"description": bson.M{"bsonType": "string"},
+		"user":        bson.M{"bsonType": "string", "minLength": 1},
+		"storageId":   bson.M{"bsonType": "string", "minLength": 1},
+		"publicUrl":   bson.M{"bsonType": "string"},
+		"createdAt":   bson.M{"bsonType": "date"},
+		"visibility":  bson.M{"enum": bson.A{"public", "unlisted", "followers", "private"}},
+	},
+}
+
+// namespaceNotFound is the code of the error collMod returns for a collection which doesn't exist
+const namespaceNotFound = 26
+
+// EnsureValidators sets $jsonSchema validators on the users and posts collections, creating them if
+// needed. The validation level is moderate, so documents saved before which don't match can still
+// be updated
+func EnsureValidators(ctx context.Context, db *mongo.Database, names Collections) error {
+	schemas := []struct {
+		collection string
+		schema     bson.M
+	}{
+		{names.Users, userSchema},
+		{names.Posts, postSchema},
+	}
+
+	for _, s := range schemas {
+		validator := bson.D{
+			{Key: "validator", Value: bson.M{"$jsonSchema": s.schema}},
+			{Key: "validationLevel", Value: "moderate"},
+			{Key: "validationAction", Value: "error"},
+		}
+
+		err := db.RunCommand(ctx, append(bson.D{{Key: "collMod", Value: s.collection}}, validator...)).Err()
+		if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Code == namespaceNotFound {
+			err = db.RunCommand(ctx, append(bson.D{{Key: "create", Value: s.collection}}, validator...)).Err()
+		}
+
+		if err != nil {
+			return fmt.Errorf("repository: validator of %s: %v", s.collection, err)
+		}
+	}
+
+	return nil
+}
+
+// isDuplicateKey reports whether err was caused by a unique index
+func isDuplicateKey(err error) bool {
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == 11000 {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return e.Code == 11000
+	}
+
+	return false
+}
@@ -0,0 +1,452 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryDB keeps users, posts, and sessions in maps guarded by a single lock, which also makes
+// every multi-document write atomic. Nothing is persisted, so it is only meant for tests and
+// offline development. Get repositories from Users, Posts, and Sessions
+type MemoryDB struct {
+	mu       sync.RWMutex
+	users    map[primitive.ObjectID]*model.User
+	posts    map[primitive.ObjectID]*model.Post
+	sessions map[primitive.ObjectID]*model.Session
+}
+
+// NewMemoryDB returns an empty MemoryDB
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		users:    map[primitive.ObjectID]*model.User{},
+		posts:    map[primitive.ObjectID]*model.Post{},
+		sessions: map[primitive.ObjectID]*model.Session{},
+	}
+}
+
+// Users returns a UserRepository backed by db
+func (db *MemoryDB) Users() *MemoryUsers {
+	return &MemoryUsers{db: db}
+}
+
+// Posts returns a PostRepository backed by db
+func (db *MemoryDB) Posts() *MemoryPosts {
+	return &MemoryPosts{db: db}
+}
+
+// Sessions returns a SessionRepository backed by db
+func (db *MemoryDB) Sessions() *MemorySessions {
+	return &MemorySessions{db: db}
+}
+
+// copyUser returns a copy of user which shares no memory with it
+func copyUser(user *model.User) *model.User {
+	c := *user
+	c.Posts = append([]primitive.ObjectID(nil), user.Posts...)
+
+	return &c
+}
+
+// copyPost returns a copy of post
+func copyPost(post *model.Post) *model.Post {
+	c := *post
+
+	return &c
+}
+
+// MemoryUsers is the UserRepository of a MemoryDB
+type MemoryUsers struct {
+	db *MemoryDB
+}
+
+// Create stores a copy of user under a new id
+func (r *MemoryUsers) Create(ctx context.Context, user *model.User) (primitive.ObjectID, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, existing := range r.db.users {
+		if existing.UserName == user.UserName || (user.Email != "" && existing.Email == user.Email) {
+			return primitive.NilObjectID, ErrDuplicate
+		}
+	}
+
+	stored := copyUser(user)
+	stored.ID = primitive.NewObjectID()
+	stored.Posts = nil
+	r.db.users[stored.ID] = stored
+
+	return stored.ID, nil
+}
+
+// FindByID returns a copy of the user with id
+func (r *MemoryUsers) FindByID(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	user, ok := r.db.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return copyUser(user), nil
+}
+
+// FindByUserName returns a copy of the user called userName
+func (r *MemoryUsers) FindByUserName(ctx context.Context, userName string) (*model.User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, user := range r.db.users {
+		if user.UserName == userName {
+			return copyUser(user), nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// OwnsPost looks for postID in the user's posts list
+func (r *MemoryUsers) OwnsPost(ctx context.Context, userID primitive.ObjectID, postID primitive.ObjectID) (bool, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	user, ok := r.db.users[userID]
+	if !ok {
+		return false, nil
+	}
+
+	return indexOf(user.Posts, postID) >= 0, nil
+}
+
+// indexOf returns the position of id in ids, or -1
+func indexOf(ids []primitive.ObjectID, id primitive.ObjectID) int {
+	for i, existing := range ids {
+		if existing == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// MemoryPosts is the PostRepository of a MemoryDB
+type MemoryPosts struct {
+	db *MemoryDB
+}
+
+// Create stores a copy of post under a new id and appends it to the user's posts
+func (r *MemoryPosts) Create(ctx context.Context, userID primitive.ObjectID, post *model.Post) (primitive.ObjectID, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	user, ok := r.db.users[userID]
+	if !ok {
+		return primitive.NilObjectID, ErrNotFound
+	}
+
+	stored := copyPost(post)
+	stored.ID = primitive.NewObjectID()
+	stored.CreatedAt = createdAt(post)
+	r.db.posts[stored.ID] = stored
+	user.Posts = append(user.Posts, stored.ID)
+
+	return stored.ID, nil
+}
+
+// FindByID returns a copy of the post with id postID
+func (r *MemoryPosts) FindByID(ctx context.Context, postID primitive.ObjectID) (*model.Post, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	post, ok := r.db.posts[postID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return copyPost(post), nil
+}
+
+// Update changes the set fields of the post
+func (r *MemoryPosts) Update(ctx context.Context, postID primitive.ObjectID, update *PostUpdate) (*model.Post, *model.Post, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	post, ok := r.db.posts[postID]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+
+	before := copyPost(post)
+
+	if update.Title != nil {
+		post.Title = *update.Title
+	}
+
+	if update.Description != nil {
+		post.Description = *update.Description
+	}
+
+	if update.StorageID != nil {
+		post.StorageID = *update.StorageID
+	}
+
+	if update.PublicURL != nil {
+		post.PublicURL = *update.PublicURL
+	}
+
+	if update.Visibility != nil {
+		post.Visibility = *update.Visibility
+	}
+
+	return before, copyPost(post), nil
+}
+
+// Delete removes the post from the user's posts and from the posts map
+func (r *MemoryPosts) Delete(ctx context.Context, userID primitive.ObjectID, postID primitive.ObjectID) (*model.Post, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	user, ok := r.db.users[userID]
+	if !ok {
+		return nil, ErrNotOwned
+	}
+
+	i := indexOf(user.Posts, postID)
+	if i < 0 {
+		return nil, ErrNotOwned
+	}
+
+	post, ok := r.db.posts[postID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	user.Posts = append(user.Posts[:i:i], user.Posts[i+1:]...)
+	delete(r.db.posts, postID)
+
+	return post, nil
+}
+
+// List returns a page of the public posts, in the order they were created
+func (r *MemoryPosts) List(ctx context.Context, page Page) ([]*model.Post, int64, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	public := []*model.Post{}
+
+	for _, post := range r.db.posts {
+		if post.Visibility == "" || post.Visibility == model.VisibilityPublic {
+			public = append(public, copyPost(post))
+		}
+	}
+
+	return paginate(public, page), int64(len(public)), nil
+}
+
+// CountPublicByUser counts the public posts whose user is userName
+func (r *MemoryPosts) CountPublicByUser(ctx context.Context, userName string) (int64, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	count := int64(0)
+
+	for _, post := range r.db.posts {
+		if post.User == userName && (post.Visibility == "" || post.Visibility == model.VisibilityPublic) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// ListByUser returns a page of the user's posts, in the order they were created
+func (r *MemoryPosts) ListByUser(ctx context.Context, userID primitive.ObjectID, page Page) ([]*model.Post, int64, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	user, ok := r.db.users[userID]
+	if !ok {
+		return nil, 0, ErrNotFound
+	}
+
+	found := []*model.Post{}
+
+	for _, id := range user.Posts {
+		if post, ok := r.db.posts[id]; ok {
+			found = append(found, copyPost(post))
+		}
+	}
+
+	return paginate(found, page), int64(len(user.Posts)), nil
+}
+
+// StorageIDs collects the storageIds of all posts
+func (r *MemoryPosts) StorageIDs(ctx context.Context) (map[string]struct{}, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	ids := map[string]struct{}{}
+
+	for _, post := range r.db.posts {
+		if post.StorageID != "" {
+			ids[post.StorageID] = struct{}{}
+		}
+	}
+
+	return ids, nil
+}
+
+// paginate sorts posts by id, which orders them by creation, and applies the page like a mongo
+// query would
+func paginate(posts []*model.Post, page Page) []*model.Post {
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].ID.Hex() < posts[j].ID.Hex()
+	})
+
+	inRange := make([]*model.Post, 0, len(posts))
+
+	for _, post := range posts {
+		if !page.After.IsZero() && bytes.Compare(post.ID[:], page.After[:]) <= 0 {
+			continue
+		}
+
+		if !page.Before.IsZero() && bytes.Compare(post.ID[:], page.Before[:]) >= 0 {
+			continue
+		}
+
+		inRange = append(inRange, post)
+	}
+
+	posts = inRange
+
+	// count back from Before by paging the reversed list
+	backwards := !page.Before.IsZero()
+	if backwards {
+		reverse(posts)
+	}
+
+	if page.Skip >= int64(len(posts)) {
+		return []*model.Post{}
+	}
+
+	if page.Skip > 0 {
+		posts = posts[page.Skip:]
+	}
+
+	if page.Limit > 0 && page.Limit < int64(len(posts)) {
+		posts = posts[:page.Limit]
+	}
+
+	if backwards {
+		reverse(posts)
+	}
+
+	return posts
+}
+
+// MemorySessions is the SessionRepository of a MemoryDB
+type MemorySessions struct {
+	db *MemoryDB
+}
+
+// Create stores a copy of session under a new id
+func (r *MemorySessions) Create(ctx context.Context, session *model.Session) (primitive.ObjectID, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored := *session
+	stored.ID = primitive.NewObjectID()
+	stored.UsedHashes = append([]string(nil), session.UsedHashes...)
+	r.db.sessions[stored.ID] = &stored
+
+	return stored.ID, nil
+}
+
+// Rotate swaps the token hash of the matching active session
+func (r *MemorySessions) Rotate(ctx context.Context, oldHash string, newHash string, now time.Time) (*model.Session, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, session := range r.db.sessions {
+		if session.TokenHash == oldHash && !session.Revoked && session.ExpiresAt.After(now) {
+			session.TokenHash = newHash
+			session.UsedHashes = append(session.UsedHashes, oldHash)
+			if len(session.UsedHashes) > model.MaxUsedHashes {
+				session.UsedHashes = session.UsedHashes[len(session.UsedHashes)-model.MaxUsedHashes:]
+			}
+
+			rotated := *session
+			rotated.UsedHashes = append([]string(nil), session.UsedHashes...)
+
+			return &rotated, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// RevokeByTokenHash revokes the session with this current token hash
+func (r *MemorySessions) RevokeByTokenHash(ctx context.Context, tokenHash string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, session := range r.db.sessions {
+		if session.TokenHash == tokenHash {
+			session.Revoked = true
+		}
+	}
+
+	return nil
+}
+
+// RevokeByUsedHash revokes the session which issued this token hash before
+func (r *MemorySessions) RevokeByUsedHash(ctx context.Context, tokenHash string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, session := range r.db.sessions {
+		for _, used := range session.UsedHashes {
+			if used == tokenHash {
+				session.Revoked = true
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsActive reports whether the session exists and is not revoked
+func (r *MemorySessions) IsActive(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	session, ok := r.db.sessions[id]
+
+	return ok && !session.Revoked, nil
+}
+
+// CountActive counts unrevoked sessions which expire after now
+func (r *MemorySessions) CountActive(ctx context.Context, now time.Time) (int64, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	count := int64(0)
+
+	for _, session := range r.db.sessions {
+		if !session.Revoked && session.ExpiresAt.After(now) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+var _ UserRepository = (*MemoryUsers)(nil)
+var _ PostRepository = (*MemoryPosts)(nil)
+var _ SessionRepository = (*MemorySessions)(nil)
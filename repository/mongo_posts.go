@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Maxbrain0/echo_mongo/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoPosts stores posts in a mongo collection. Writes which also change a user's posts list use
+// transactions, so Client must be connected to a replica set
+type MongoPosts struct {
+	Client         *mongo.Client
+	PostCollection *mongo.Collection
+	UserCollection *mongo.Collection
+}
+
+// NewMongoPosts returns a PostRepository backed by the posts and users collections
+func NewMongoPosts(client *mongo.Client, postCollection *mongo.Collection, userCollection *mongo.Collection) *MongoPosts {
+	return &MongoPosts{Client: client, PostCollection: postCollection, UserCollection: userCollection}
+}
+
+// Create inserts the post and adds it to the user's posts array in one transaction, so a post is
+// never saved without being in its user's list
+func (r *MongoPosts) Create(ctx context.Context, userID primitive.ObjectID, post *model.Post) (primitive.ObjectID, error) {
+	doc := *post
+	doc.ID = primitive.NewObjectID()
+	doc.CreatedAt = createdAt(post)
+
+	err := withTransaction(ctx, r.Client, func(sc mongo.SessionContext) error {
+		if _, err := r.PostCollection.InsertOne(sc, &doc); err != nil {
+			return err
+		}
+
+		// update record of the user... add to this user's posts array
+		err := r.UserCollection.FindOneAndUpdate(sc, bson.M{"_id": userID}, bson.M{"$addToSet": bson.M{"posts": doc.ID}}).Err()
+		if err == mongo.ErrNoDocuments {
+			return ErrNotFound
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	return doc.ID, nil
+}
+
+// FindByID finds a post by _id
+func (r *MongoPosts) FindByID(ctx context.Context, postID primitive.ObjectID) (*model.Post, error) {
+	post := &model.Post{}
+
+	err := r.PostCollection.FindOne(ctx, bson.M{"_id": postID}).Decode(post)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// Update reads the current post and sets the changed fields in one transaction
+func (r *MongoPosts) Update(ctx context.Context, postID primitive.ObjectID, update *PostUpdate) (*model.Post, *model.Post, error) {
+	// we start with empty map and add properties conditionally if they are requested
+	fields := bson.M{}
+
+	if update.Title != nil {
+		fields["title"] = *update.Title
+	}
+
+	if update.Description != nil {
+		fields["description"] = *update.Description
+	}
+
+	if update.StorageID != nil {
+		fields["storageId"] = *update.StorageID
+	}
+
+	if update.PublicURL != nil {
+		fields["publicUrl"] = *update.PublicURL
+	}
+
+	if update.Visibility != nil {
+		fields["visibility"] = *update.Visibility
+	}
+
+	before := &model.Post{}
+	after := &model.Post{}
+
+	// return newly updated docuemnt instead of old one (the default return value)
+	updateOptions := options.FindOneAndUpdate()
+	updateOptions.SetReturnDocument(options.After)
+
+	err := withTransaction(ctx, r.Client, func(sc mongo.SessionContext) error {
+		if err := r.PostCollection.FindOne(sc, bson.M{"_id": postID}).Decode(before); err != nil {
+			return err
+		}
+
+		// mongo rejects an empty $set, and there is nothing to change anyway
+		if len(fields) == 0 {
+			*after = *before
+			return nil
+		}
+
+		return r.PostCollection.FindOneAndUpdate(sc, bson.M{"_id": postID}, bson.M{"$set": fields}, updateOptions).Decode(after)
+	})
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return before, after, nil
+}
+
+// Delete pulls the post from the user's posts array, and if it was there, deletes the post, all in
+// one transaction
+func (r *MongoPosts) Delete(ctx context.Context, userID primitive.ObjectID, postID primitive.ObjectID) (*model.Post, error) {
+	deleted := &model.Post{}
+
+	err := withTransaction(ctx, r.Client, func(sc mongo.SessionContext) error {
+		updateResult, err := r.UserCollection.UpdateOne(
+			sc,
+			bson.M{
+				"_id": userID,
+			},
+			bson.M{
+				"$pull": bson.M{
+					"posts": postID,
+				},
+			},
+		)
+
+		if err != nil {
+			return err
+		}
+
+		// if the post list was not modified
+		if updateResult.ModifiedCount == 0 {
+			return ErrNotOwned
+		}
+
+		// if we did modify users list, we can delete post from Posts Collection
+		return r.PostCollection.FindOneAndDelete(sc, bson.M{
+			"_id": postID,
+		}).Decode(deleted)
+	})
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+// publicFilter matches public posts, including those saved before posts had a visibility
+var publicFilter = bson.M{"visibility": bson.M{"$in": bson.A{model.VisibilityPublic, nil}}}
+
+// List finds a page of the public posts
+func (r *MongoPosts) List(ctx context.Context, page Page) ([]*model.Post, int64, error) {
+	total, err := r.PostCollection.CountDocuments(ctx, publicFilter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	found, err := r.find(ctx, publicFilter, page)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return found, total, nil
+}
+
+// CountPublicByUser counts the public posts whose user is userName
+func (r *MongoPosts) CountPublicByUser(ctx context.Context, userName string) (int64, error) {
+	return r.PostCollection.CountDocuments(ctx, bson.M{"user": userName, "visibility": publicFilter["visibility"]})
+}
+
+// ListByUser finds a page of the posts in the user's posts array
+func (r *MongoPosts) ListByUser(ctx context.Context, userID primitive.ObjectID, page Page) ([]*model.Post, int64, error) {
+	// retrieve user's list of post ObjectID's from UserCollection - need to return total count, too
+	user := &model.User{}
+
+	err := r.UserCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(user)
+	if err == mongo.ErrNoDocuments {
+		return nil, 0, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	found, err := r.find(ctx, bson.M{"_id": bson.M{"$in": user.Posts}}, page)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return found, int64(len(user.Posts)), nil
+}
+
+// StorageIDs returns the set of storageId values referenced by posts
+func (r *MongoPosts) StorageIDs(ctx context.Context) (map[string]struct{}, error) {
+	findOptions := options.Find()
+	findOptions.SetProjection(bson.M{"storageId": 1})
+
+	cursor, err := r.PostCollection.Find(ctx, bson.M{"storageId": bson.M{"$exists": true}}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	ids := map[string]struct{}{}
+
+	for cursor.Next(ctx) {
+		elem := &model.Post{}
+		if err := cursor.Decode(elem); err != nil {
+			return nil, err
+		}
+
+		ids[elem.StorageID] = struct{}{}
+	}
+
+	return ids, cursor.Err()
+}
+
+// find decodes a page of the posts matching filter, sorted by _id, which orders them by creation.
+// Pages before a post are read backwards from it, and then put back in order
+func (r *MongoPosts) find(ctx context.Context, filter bson.M, page Page) ([]*model.Post, error) {
+	idRange := bson.M{}
+
+	if !page.After.IsZero() {
+		idRange["$gt"] = page.After
+	}
+
+	if !page.Before.IsZero() {
+		idRange["$lt"] = page.Before
+	}
+
+	if len(idRange) > 0 {
+		filter = bson.M{"$and": bson.A{filter, bson.M{"_id": idRange}}}
+	}
+
+	order := 1
+	if !page.Before.IsZero() {
+		order = -1
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "_id", Value: order}})
+	findOptions.SetLimit(page.Limit)
+	findOptions.SetSkip(page.Skip)
+
+	cursor, err := r.PostCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	// decode response into a slice of posts
+	found := []*model.Post{}
+
+	for cursor.Next(ctx) {
+		elem := &model.Post{} // type to decode into... dangling preposition! O shame!
+		if err := cursor.Decode(elem); err != nil {
+			return nil, err
+		}
+
+		found = append(found, elem)
+	}
+
+	if order < 0 {
+		reverse(found)
+	}
+
+	return found, cursor.Err()
+}
+
+var _ PostRepository = (*MongoPosts)(nil)
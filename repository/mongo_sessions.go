@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoSessions stores sessions in a mongo collection
+type MongoSessions struct {
+	Collection *mongo.Collection
+}
+
+// NewMongoSessions returns a SessionRepository backed by collection
+func NewMongoSessions(collection *mongo.Collection) *MongoSessions {
+	return &MongoSessions{Collection: collection}
+}
+
+// Create inserts the session
+func (r *MongoSessions) Create(ctx context.Context, session *model.Session) (primitive.ObjectID, error) {
+	res, err := r.Collection.InsertOne(ctx, session)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	return res.InsertedID.(primitive.ObjectID), nil
+}
+
+// Rotate swaps in the new token hash with a single FindOneAndUpdate, so a refresh token can only
+// ever be exchanged once
+func (r *MongoSessions) Rotate(ctx context.Context, oldHash string, newHash string, now time.Time) (*model.Session, error) {
+	session := &model.Session{}
+	updateOptions := options.FindOneAndUpdate()
+	updateOptions.SetReturnDocument(options.After)
+
+	err := r.Collection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"tokenHash": oldHash,
+			"revoked":   false,
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{
+			"$set":  bson.M{"tokenHash": newHash},
+			"$push": bson.M{"usedHashes": bson.M{"$each": bson.A{oldHash}, "$slice": -model.MaxUsedHashes}},
+		},
+		updateOptions,
+	).Decode(session)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// RevokeByTokenHash marks the session with this current token hash as revoked
+func (r *MongoSessions) RevokeByTokenHash(ctx context.Context, tokenHash string) error {
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"tokenHash": tokenHash}, bson.M{"$set": bson.M{"revoked": true}})
+
+	return err
+}
+
+// RevokeByUsedHash marks the session which issued this token hash before as revoked
+func (r *MongoSessions) RevokeByUsedHash(ctx context.Context, tokenHash string) error {
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"usedHashes": tokenHash}, bson.M{"$set": bson.M{"revoked": true}})
+
+	return err
+}
+
+// IsActive counts unrevoked sessions with this _id
+func (r *MongoSessions) IsActive(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	count, err := r.Collection.CountDocuments(ctx, bson.M{"_id": id, "revoked": false})
+
+	return count > 0, err
+}
+
+// CountActive counts unrevoked sessions which expire after now
+func (r *MongoSessions) CountActive(ctx context.Context, now time.Time) (int64, error) {
+	return r.Collection.CountDocuments(ctx, bson.M{"revoked": false, "expiresAt": bson.M{"$gt": now}})
+}
+
+var _ SessionRepository = (*MongoSessions)(nil)
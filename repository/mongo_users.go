@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Maxbrain0/echo_mongo/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoUsers stores users in a mongo collection
+type MongoUsers struct {
+	Collection *mongo.Collection
+}
+
+// NewMongoUsers returns a UserRepository backed by collection
+func NewMongoUsers(collection *mongo.Collection) *MongoUsers {
+	return &MongoUsers{Collection: collection}
+}
+
+// Create inserts the user. The unique indexes of EnsureIndexes reject taken user names and emails,
+// even when two signups race
+func (r *MongoUsers) Create(ctx context.Context, user *model.User) (primitive.ObjectID, error) {
+	doc := bson.M{"userName": user.UserName, "password": user.Password}
+
+	// leave out a missing email, so it isn't indexed as a duplicate empty string
+	if user.Email != "" {
+		doc["email"] = user.Email
+	}
+
+	res, err := r.Collection.InsertOne(ctx, doc)
+	if isDuplicateKey(err) {
+		return primitive.NilObjectID, ErrDuplicate
+	}
+
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	return res.InsertedID.(primitive.ObjectID), nil
+}
+
+// FindByID finds a user by _id
+func (r *MongoUsers) FindByID(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+// FindByUserName finds a user by userName
+func (r *MongoUsers) FindByUserName(ctx context.Context, userName string) (*model.User, error) {
+	return r.findOne(ctx, bson.M{"userName": userName})
+}
+
+// OwnsPost counts the users with this _id and post in their posts list
+func (r *MongoUsers) OwnsPost(ctx context.Context, userID primitive.ObjectID, postID primitive.ObjectID) (bool, error) {
+	count, err := r.Collection.CountDocuments(ctx, bson.M{
+		"_id":   userID,
+		"posts": postID,
+	})
+
+	return count > 0, err
+}
+
+// findOne decodes the first user matching filter
+func (r *MongoUsers) findOne(ctx context.Context, filter bson.M) (*model.User, error) {
+	user := &model.User{}
+
+	err := r.Collection.FindOne(ctx, filter).Decode(user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+var _ UserRepository = (*MongoUsers)(nil)
@@ -0,0 +1,119 @@
+// Package repository hides how users, posts, and sessions are stored from the controllers. There is
+// a MongoDB implementation, and an in-memory one for tests and offline development
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Maxbrain0/echo_mongo/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNotFound is returned when a requested document does not exist
+var ErrNotFound = errors.New("repository: not found")
+
+// ErrDuplicate is returned when creating a document would break a uniqueness rule, ie a taken user name
+var ErrDuplicate = errors.New("repository: duplicate")
+
+// ErrNotOwned is returned when a post is not in the given user's posts list
+var ErrNotOwned = errors.New("repository: post does not belong to user")
+
+// ErrCommitUnknown is wrapped by errors of writes whose transaction may or may not have been committed,
+// ie because the connection dropped during the commit. Check for it with errors.Is
+var ErrCommitUnknown = errors.New("repository: transaction commit result unknown")
+
+// Page limits the posts returned by a list, which are in the order they were created. A Limit of 0
+// means no limit
+type Page struct {
+	Limit int64
+	Skip  int64
+	// After keeps only the posts created after the post with this id, unless it is zero
+	After primitive.ObjectID
+	// Before keeps only the posts created before the post with this id, unless it is zero. Limit and
+	// Skip then count back from it, so the page is the last posts before Before
+	Before primitive.ObjectID
+}
+
+// PostUpdate holds the fields of a post to change. Nil fields are left as they are
+type PostUpdate struct {
+	Title       *string
+	Description *string
+	StorageID   *string
+	PublicURL   *string
+	Visibility  *model.Visibility
+}
+
+// UserRepository stores users
+type UserRepository interface {
+	// Create stores a new user, returning ErrDuplicate if the user name or email is taken
+	Create(ctx context.Context, user *model.User) (primitive.ObjectID, error)
+	// FindByID returns the user with id, or ErrNotFound
+	FindByID(ctx context.Context, id primitive.ObjectID) (*model.User, error)
+	// FindByUserName returns the user called userName, or ErrNotFound
+	FindByUserName(ctx context.Context, userName string) (*model.User, error)
+	// OwnsPost reports whether postID is in the posts list of user userID
+	OwnsPost(ctx context.Context, userID primitive.ObjectID, postID primitive.ObjectID) (bool, error)
+}
+
+// PostRepository stores posts, and keeps each user's posts list in step with them
+type PostRepository interface {
+	// Create stores post and adds it to the posts list of user userID, atomically. Returns
+	// ErrNotFound if there is no such user
+	Create(ctx context.Context, userID primitive.ObjectID, post *model.Post) (primitive.ObjectID, error)
+	// FindByID returns the post with id postID, or ErrNotFound
+	FindByID(ctx context.Context, postID primitive.ObjectID) (*model.Post, error)
+	// Update changes the fields set in update, returning the post before and after the change.
+	// Returns ErrNotFound if there is no such post
+	Update(ctx context.Context, postID primitive.ObjectID, update *PostUpdate) (*model.Post, *model.Post, error)
+	// Delete removes a post and takes it off the user's posts list, atomically, returning the
+	// deleted post. Returns ErrNotOwned if the post is not in the user's list, and ErrNotFound if
+	// it is, but the post itself is gone
+	Delete(ctx context.Context, userID primitive.ObjectID, postID primitive.ObjectID) (*model.Post, error)
+	// List returns a page of the public posts, along with their total number. Posts without a
+	// visibility are public
+	List(ctx context.Context, page Page) ([]*model.Post, int64, error)
+	// CountPublicByUser returns the number of public posts of the user called userName
+	CountPublicByUser(ctx context.Context, userName string) (int64, error)
+	// ListByUser returns a page of all the posts of user userID, whatever their visibility, along
+	// with their total number.
+	// Returns ErrNotFound if there is no such user
+	ListByUser(ctx context.Context, userID primitive.ObjectID, page Page) ([]*model.Post, int64, error)
+	// StorageIDs returns the set of storageIds referenced by posts
+	StorageIDs(ctx context.Context) (map[string]struct{}, error)
+}
+
+// SessionRepository stores login sessions and the hashes of their refresh tokens
+type SessionRepository interface {
+	// Create stores a new session
+	Create(ctx context.Context, session *model.Session) (primitive.ObjectID, error)
+	// Rotate replaces the refresh token hash oldHash of an active, unexpired session with newHash, and
+	// returns the updated session. Returns ErrNotFound if there is no such session
+	Rotate(ctx context.Context, oldHash string, newHash string, now time.Time) (*model.Session, error)
+	// RevokeByTokenHash revokes the session whose current refresh token hash is tokenHash
+	RevokeByTokenHash(ctx context.Context, tokenHash string) error
+	// RevokeByUsedHash revokes the session that previously issued the refresh token hash tokenHash
+	RevokeByUsedHash(ctx context.Context, tokenHash string) error
+	// IsActive reports whether session id exists and is not revoked
+	IsActive(ctx context.Context, id primitive.ObjectID) (bool, error)
+	// CountActive returns the number of sessions which are neither revoked nor expired at now
+	CountActive(ctx context.Context, now time.Time) (int64, error)
+}
+
+// createdAt returns the creation time of a new post: its CreatedAt if already set, or now. Mongo
+// stores milliseconds, so the time is truncated to match what is read back
+func createdAt(post *model.Post) time.Time {
+	if !post.CreatedAt.IsZero() {
+		return post.CreatedAt
+	}
+
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// reverse reverses posts in place
+func reverse(posts []*model.Post) {
+	for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+		posts[i], posts[j] = posts[j], posts[i]
+	}
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxTransactionAttempts bounds how often a transaction is retried after a transient error
+const maxTransactionAttempts = 3
+
+// withTransaction runs fn in a transaction, committing if fn returns nil and aborting otherwise.
+// Transactions are retried when mongo labels an error as transient. Note that transactions need
+// mongo to run as a replica set (see docker-compose.yml)
+func withTransaction(ctx context.Context, client *mongo.Client, fn func(mongo.SessionContext) error) error {
+	return client.UseSession(ctx, func(sc mongo.SessionContext) error {
+		var err error
+
+		for attempt := 0; attempt < maxTransactionAttempts; attempt++ {
+			if err = sc.StartTransaction(); err != nil {
+				return err
+			}
+
+			if err = fn(sc); err == nil {
+				err = commit(sc)
+			}
+
+			if err == nil {
+				return nil
+			}
+
+			// aborting after a failed commit is an error too, which we don't care about
+			sc.AbortTransaction(sc)
+
+			if !hasErrorLabel(err, "TransientTransactionError") || sc.Err() != nil {
+				return err
+			}
+		}
+
+		return err
+	})
+}
+
+// commit commits the session's transaction, retrying if the outcome of the commit is unknown. If it
+// is still unknown after the last attempt, the error wraps ErrCommitUnknown
+func commit(sc mongo.SessionContext) error {
+	var err error
+
+	for attempt := 0; attempt < maxTransactionAttempts; attempt++ {
+		err = sc.CommitTransaction(sc)
+
+		if !hasErrorLabel(err, "UnknownTransactionCommitResult") {
+			return err
+		}
+
+		if sc.Err() != nil {
+			break
+		}
+	}
+
+	return fmt.Errorf("%w: %v", ErrCommitUnknown, err)
+}
+
+// hasErrorLabel reports whether err is a mongo command error carrying label
+func hasErrorLabel(err error, label string) bool {
+	cmdErr, ok := err.(mongo.CommandError)
+
+	return ok && cmdErr.HasErrorLabel(label)
+}
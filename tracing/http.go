@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"github.com/Maxbrain0/echo_mongo/internal/instrument"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a server span for each request, continuing the trace of an incoming traceparent
+// header. The span is stored in the request context, so spans of the database and storage calls
+// made with that context become its children. Register it before the routes' own middleware
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			// the route isn't known until the router ran, so the span is renamed below
+			ctx, span := tracer().Start(ctx, req.Method, trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(semconv.HTTPMethodKey.String(req.Method), semconv.HTTPTargetKey.String(req.URL.Path)))
+			defer span.End()
+
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			if err != nil {
+				span.RecordError(err)
+			}
+
+			if route := c.Path(); route != "" {
+				span.SetName(req.Method + " " + route)
+				span.SetAttributes(semconv.HTTPRouteKey.String(route))
+			}
+
+			status := instrument.Status(c, err)
+			span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+
+			if code, message := semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(status, trace.SpanKindServer); code == codes.Error {
+				span.SetStatus(code, message)
+			}
+
+			return err
+		}
+	}
+}
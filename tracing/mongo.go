@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/Maxbrain0/echo_mongo/internal/instrument"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CommandMonitor returns a MongoDB command monitor which records a client span for every command,
+// as a child of the span in the context the command was run with. Pass it to
+// options.Client().SetMonitor
+func CommandMonitor() *event.CommandMonitor {
+	// the span is started and ended by different events, which share the connection and request id
+	var spans sync.Map
+
+	key := func(connectionID string, requestID int64) string {
+		return connectionID + "/" + strconv.FormatInt(requestID, 10)
+	}
+
+	finished := func(e *event.CommandFinishedEvent, failure string) {
+		s, ok := spans.Load(key(e.ConnectionID, e.RequestID))
+		if !ok {
+			return
+		}
+
+		spans.Delete(key(e.ConnectionID, e.RequestID))
+		span := s.(trace.Span)
+
+		if failure != "" {
+			span.RecordError(errors.New(failure))
+			span.SetStatus(codes.Error, failure)
+		}
+
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			collection := instrument.CommandCollection(e)
+
+			name := e.CommandName
+			if collection != "" {
+				name = collection + "." + e.CommandName
+			}
+
+			_, span := tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+				semconv.DBSystemMongoDB,
+				semconv.DBNameKey.String(e.DatabaseName),
+				semconv.DBOperationKey.String(e.CommandName),
+				semconv.DBMongoDBCollectionKey.String(collection),
+			))
+
+			spans.Store(key(e.ConnectionID, e.RequestID), span)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finished(&e.CommandFinishedEvent, "")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finished(&e.CommandFinishedEvent, e.Failure)
+		},
+	}
+}
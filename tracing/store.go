@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"io"
+
+	"github.com/Maxbrain0/echo_mongo/blobstore"
+	"github.com/Maxbrain0/echo_mongo/internal/instrument"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Store wraps a blobstore.Store, recording a span for each operation
+type Store struct {
+	blobstore.Store
+	// Backend is added to the spans, ie gcs or s3
+	Backend string
+}
+
+// InstrumentStore returns store with spans labelled by backend
+func InstrumentStore(store blobstore.Store, backend string) *Store {
+	return &Store{Store: store, Backend: backend}
+}
+
+// start begins the span of an operation on key, which may be empty
+func (s *Store) start(ctx context.Context, operation string, key string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("storage.backend", s.Backend)}
+	if key != "" {
+		attrs = append(attrs, attribute.String("storage.key", key))
+	}
+
+	return tracer().Start(ctx, "storage."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// end finishes span, marking it failed for errors other than a missing object
+func end(span trace.Span, err error) {
+	if err != nil && err != blobstore.ErrNotExist {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Put uploads r, recording its size on the span
+func (s *Store) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	ctx, span := s.start(ctx, "put", key)
+	counted, counter := instrument.Count(r)
+
+	err := s.Store.Put(ctx, key, counted, contentType)
+	span.SetAttributes(attribute.Int64("storage.bytes", counter.N()), attribute.String("storage.content_type", contentType))
+	end(span, err)
+
+	return err
+}
+
+// Delete removes key
+func (s *Store) Delete(ctx context.Context, key string) error {
+	ctx, span := s.start(ctx, "delete", key)
+	err := s.Store.Delete(ctx, key)
+	end(span, err)
+
+	return err
+}
+
+// Open returns a reader for key. The span only covers opening, not reading
+func (s *Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	ctx, span := s.start(ctx, "open", key)
+	rc, err := s.Store.Open(ctx, key)
+	end(span, err)
+
+	return rc, err
+}
+
+// List returns every object
+func (s *Store) List(ctx context.Context) ([]blobstore.Object, error) {
+	ctx, span := s.start(ctx, "list", "")
+	objects, err := s.Store.List(ctx)
+	span.SetAttributes(attribute.Int("storage.objects", len(objects)))
+	end(span, err)
+
+	return objects, err
+}
+
+// Check tests whether the store can be reached
+func (s *Store) Check(ctx context.Context) error {
+	ctx, span := s.start(ctx, "check", "")
+	err := s.Store.Check(ctx)
+	end(span, err)
+
+	return err
+}
+
+var _ blobstore.Store = (*Store)(nil)
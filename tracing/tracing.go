@@ -0,0 +1,89 @@
+// Package tracing sets up OpenTelemetry tracing, and creates spans for http requests, MongoDB
+// commands, and image storage operations. Trace context is propagated with the W3C traceparent header
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of this package
+const instrumentationName = "github.com/Maxbrain0/echo_mongo/tracing"
+
+// Config selects where spans are sent
+type Config struct {
+	// Exporter is none, stdout, or otlp. With none, spans are not recorded at all
+	Exporter string
+	// Endpoint is the host:port of the OTLP/HTTP collector, ie localhost:4318. When empty, the
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable or the exporter's default is used
+	Endpoint string
+	// Insecure sends spans to the collector over http instead of https
+	Insecure bool
+	// ServiceName identifies this server in traces
+	ServiceName string
+	// SampleRatio is the fraction of new traces which are recorded. Requests which carry a
+	// traceparent header follow the sampling decision of their caller
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider and the W3C trace context propagator. The returned
+// function flushes remaining spans, and should be called on shutdown
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch cfg.Exporter {
+	case "none", "":
+		// the global provider is a no-op until one is set
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		// stdout carries the json logs, so spans go to stderr, one per line like the logs
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	case "otlp":
+		opts := []otlptracehttp.Option{}
+
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q", cfg.Exporter)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(cfg.ServiceName))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// tracer returns the tracer of the global provider. It is looked up on each use, so spans go to
+// the provider installed by Setup even if it ran after the instrumented code was created
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
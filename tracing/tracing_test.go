@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Maxbrain0/echo_mongo/blobstore"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// record installs a provider which keeps every span in memory
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	return recorder
+}
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	recorder := record(t)
+	store := InstrumentStore(blobstore.NewMemory("/uploads"), "memory")
+
+	e := echo.New()
+	e.Use(Middleware())
+	e.POST("/posts/:id", func(c echo.Context) error {
+		store.Put(c.Request().Context(), "a.png", strings.NewReader("12345"), "image/png")
+		return echo.NewHTTPError(http.StatusInternalServerError, "something broke")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/posts/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected a storage and a request span, got %d", len(spans))
+	}
+
+	put, server := spans[0], spans[1]
+
+	if server.Name() != "POST /posts/:id" || server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("unexpected server span %q of kind %v", server.Name(), server.SpanKind())
+	}
+
+	if server.Parent().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("expected the server span to continue the incoming trace, got parent %v", server.Parent())
+	}
+
+	if server.Status().Code != codes.Error {
+		t.Errorf("expected a 500 to mark the span failed, got %v", server.Status())
+	}
+
+	if put.Name() != "storage.put" || put.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("expected the storage span %q to be a child of the request", put.Name())
+	}
+}
+
+func TestStoreIgnoresMissingObjects(t *testing.T) {
+	recorder := record(t)
+	store := InstrumentStore(blobstore.NewMemory("/uploads"), "memory")
+
+	store.Delete(context.Background(), "missing.png")
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Status().Code == codes.Error {
+		t.Errorf("expected one successful delete span, got %v", spans)
+	}
+}
@@ -1,26 +1,41 @@
 package util
 
 import (
-	"github.com/dgrijalva/jwt-go"
+	"errors"
+
+	"github.com/Maxbrain0/echo_mongo/auth"
 	"github.com/labstack/echo/v4"
 )
 
-// GetUID utility extracts Username from jwt via ECHO middleware
-func GetUID(c echo.Context) string {
-	return c.Get("user").(*jwt.Token).Claims.(jwt.MapClaims)["userId"].(string)
+// ErrNoPrincipal is returned for requests which did not pass through the JWT middleware
+var ErrNoPrincipal = errors.New("no authenticated user in request")
+
+// GetPrincipal returns the verified user of the request, set in context by the JWT middleware
+func GetPrincipal(c echo.Context) (*auth.Principal, error) {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return nil, ErrNoPrincipal
+	}
+
+	return principal, nil
 }
 
-// GetUserName utility extracts Username from jwt via ECHO middleware
-func GetUserName(c echo.Context) string {
-	return c.Get("user").(*jwt.Token).Claims.(jwt.MapClaims)["userName"].(string)
+// GetUID utility extracts the user id from the jwt via ECHO middleware, or "" without one
+func GetUID(c echo.Context) string {
+	principal, err := GetPrincipal(c)
+	if err != nil {
+		return ""
+	}
+
+	return principal.UserID.Hex()
 }
 
-// ContainsImage assures that the MIME-Type of an uploaded file is a supported image format
-func ContainsImage(s []string) bool {
-	for _, a := range s {
-		if a == "image/jpeg" || a == "image/gif" || a == "image/png" || a == "image/svg+xml" || a == "image/webp" {
-			return true
-		}
+// GetUserName utility extracts Username from jwt via ECHO middleware, or "" without one
+func GetUserName(c echo.Context) string {
+	principal, err := GetPrincipal(c)
+	if err != nil {
+		return ""
 	}
-	return false
+
+	return principal.UserName
 }
@@ -0,0 +1,146 @@
+// Package validation checks request payloads against the validate tags of the model structs. It
+// plugs into echo as its Validator, so handlers call c.Validate after c.Bind
+package validation
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Maxbrain0/echo_mongo/apierror"
+	"github.com/go-playground/validator/v10"
+)
+
+// userNamePattern allows letters, digits, and . _ - in user names, which appear in urls and logs
+var userNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// FieldError describes why a single field is invalid. Field is the name used in json
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Validator implements echo.Validator
+type Validator struct {
+	validate *validator.Validate
+}
+
+// New returns a Validator with the rules used by the model tags:
+//   - username: letters, digits, and . _ -
+//   - singleline: no control characters, ie newlines
+//   - text: no control characters except newlines and tabs
+//   - maxbytes: at most this many bytes, where max counts characters
+func New() *Validator {
+	v := validator.New()
+
+	// report fields by their json name, which is what clients sent
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" || name == "" {
+			return field.Name
+		}
+
+		return name
+	})
+
+	v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return userNamePattern.MatchString(fl.Field().String())
+	})
+
+	v.RegisterValidation("singleline", func(fl validator.FieldLevel) bool {
+		return !strings.ContainsFunc(fl.Field().String(), unicode.IsControl)
+	})
+
+	v.RegisterValidation("text", func(fl validator.FieldLevel) bool {
+		return !strings.ContainsFunc(fl.Field().String(), func(r rune) bool {
+			return unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t'
+		})
+	})
+
+	v.RegisterValidation("maxbytes", func(fl validator.FieldLevel) bool {
+		limit, err := strconv.Atoi(fl.Param())
+		if err != nil {
+			panic("validation: maxbytes needs a number, not " + fl.Param())
+		}
+
+		return len(fl.Field().String()) <= limit
+	})
+
+	return &Validator{validate: v}
+}
+
+// partial asks Validate to check only some fields of a struct
+type partial struct {
+	value  interface{}
+	fields []string
+}
+
+// Fields makes Validate check only the named fields of the struct s, ie the fields sent with a
+// request which changes just those. Fields are named as in Go, not json
+func Fields(s interface{}, fields ...string) interface{} {
+	return &partial{value: s, fields: fields}
+}
+
+// Validate checks i, returning an apierror.ErrValidation with a FieldError for every invalid field
+func (v *Validator) Validate(i interface{}) error {
+	var err error
+
+	if p, ok := i.(*partial); ok {
+		err = v.validate.StructPartial(p.value, p.fields...)
+	} else {
+		err = v.validate.Struct(i)
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	invalid, ok := err.(validator.ValidationErrors)
+	if !ok {
+		// not a struct, which is a bug in the handler rather than a bad request
+		return err
+	}
+
+	details := []*FieldError{}
+
+	for _, fe := range invalid {
+		details = append(details, &FieldError{Field: fe.Field(), Rule: fe.Tag(), Message: message(fe)})
+	}
+
+	return apierror.ErrValidation.WithDetails(details)
+}
+
+// message explains a failed rule in words
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return "must be at least " + fe.Param() + " characters long"
+		}
+
+		return "must be at least " + fe.Param()
+	case "max":
+		if fe.Kind() == reflect.String {
+			return "must be at most " + fe.Param() + " characters long"
+		}
+
+		return "must be at most " + fe.Param()
+	case "oneof":
+		return "must be one of " + strings.Replace(fe.Param(), " ", ", ", -1)
+	case "maxbytes":
+		return "must be at most " + fe.Param() + " bytes long"
+	case "email":
+		return "must be an email address"
+	case "username":
+		return "may only contain letters, digits, and . _ -"
+	case "singleline", "text":
+		return "must not contain control characters"
+	default:
+		return "must satisfy " + fe.Tag()
+	}
+}